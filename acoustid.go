@@ -0,0 +1,161 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acoustIDInterval is the minimal interval between requests to AcoustID,
+// which allows 3 requests per second.
+const acoustIDInterval = time.Second / 3
+
+// fingerprint is a Chromaprint fingerprint of audio.
+type fingerprint struct {
+	Duration    float64 `json:"duration"`
+	Fingerprint string  `json:"fingerprint"`
+}
+
+// calcFingerprint calculates fingerprint of file in path with fpcalc,
+// which is a command line tool of Chromaprint.
+func calcFingerprint(ctx context.Context, fpcalc, path string) (fingerprint, error) {
+	out, err := exec.CommandContext(ctx, fpcalc, "-json", path).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fingerprint{}, fmt.Errorf("fpcalc: %v", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fingerprint{}, fmt.Errorf("fpcalc: %v", err)
+	}
+
+	var fp fingerprint
+	if err := json.Unmarshal(out, &fp); err != nil {
+		return fingerprint{}, fmt.Errorf("fpcalc: %v", err)
+	}
+	return fp, nil
+}
+
+// acoustIDRecording is a recording found by fingerprint.
+// IDs of recordings are MusicBrainz IDs.
+type acoustIDRecording struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Artists []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+	} `json:"artists"`
+
+	// Score is a score of fingerprint match from 0 to 1.
+	Score float64 `json:"-"`
+}
+
+// Artist returns artist of r as it's credited.
+func (r *acoustIDRecording) Artist() string {
+	var b strings.Builder
+	for i, a := range r.Artists {
+		b.WriteString(a.Name)
+		if a.JoinPhrase != "" {
+			b.WriteString(a.JoinPhrase)
+		} else if i < len(r.Artists)-1 {
+			b.WriteString(", ")
+		}
+	}
+	return b.String()
+}
+
+// acoustIDClient looks up fingerprints in AcoustID.
+// Requests are rate-limited.
+type acoustIDClient struct {
+	url    string
+	key    string
+	client *http.Client
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newAcoustIDClient returns client of AcoustID API at url
+// with application API key.
+func newAcoustIDClient(url, key string) *acoustIDClient {
+	return &acoustIDClient{
+		url:    strings.TrimSuffix(url, "/"),
+		key:    key,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// lookup returns the best recording matching fp.
+// If there is no such recording, it returns nil.
+func (c *acoustIDClient) lookup(ctx context.Context, fp fingerprint) (*acoustIDRecording, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d := time.Until(c.next); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() { c.next = time.Now().Add(acoustIDInterval) }()
+
+	// Fingerprints are long, so they're sent in body.
+	form := url.Values{
+		"client":      {c.key},
+		"format":      {"json"},
+		"meta":        {"recordings"},
+		"duration":    {strconv.Itoa(int(fp.Duration))},
+		"fingerprint": {fp.Fingerprint},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/v2/lookup", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", mbUserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+		Error  struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Results []struct {
+			Score      float64              `json:"score"`
+			Recordings []*acoustIDRecording `json:"recordings"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("acoustid: %v: %v", resp.Status, err)
+	}
+	if result.Status != "ok" {
+		return nil, fmt.Errorf("acoustid: %v", result.Error.Message)
+	}
+
+	// Results are sorted by score.
+	for _, r := range result.Results {
+		if len(r.Recordings) > 0 {
+			rec := r.Recordings[0]
+			rec.Score = r.Score
+			return rec, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// fileAction is an action on found files selected by --copy-to,
+// --move-to or --link-to.
+type fileAction struct {
+	// dir is a directory, to which files are copied, moved or linked.
+	dir string
+	do  func(src, dest string) error
+	// done reports whether src is already at dest.
+	done func(src, dest string) bool
+}
+
+// flagAction returns action selected by flags or nil, if there is no one.
+func flagAction() (*fileAction, error) {
+	var action *fileAction
+	var n int
+	if flagCopyTo != "" {
+		n++
+		action = &fileAction{dir: flagCopyTo, do: copyFile, done: isCopy}
+	}
+	if flagMoveTo != "" {
+		n++
+		action = &fileAction{dir: flagMoveTo, do: moveFile, done: sameFile}
+	}
+	if flagLinkTo != "" {
+		n++
+		action = &fileAction{dir: flagLinkTo, do: os.Link, done: sameFile}
+	}
+	if n > 1 {
+		return nil, errors.New("enter only one of --copy-to, --move-to and --link-to")
+	}
+	return action, nil
+}
+
+// run copies, moves or links files found in roots to a.dir and prints
+// changes. With --keep-dirs, paths of files relative to roots are kept.
+func (a *fileAction) run(roots, files []string, stats tagrep.Stats) {
+	sort.Strings(files)
+	summary := newChangeSummary()
+
+	// taken are destinations of files.
+	taken := make(map[string]bool)
+	for _, path := range files {
+		name := filepath.Base(path)
+		if flagKeepDirs {
+			name = relPath(roots, path)
+		}
+		dest, err := freePath(path, filepath.Join(a.dir, name), taken, a.done)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		taken[dest] = true
+		if a.done(path, dest) {
+			summary.change(path, nil)
+			continue
+		}
+
+		if !flagDryRun {
+			err := os.MkdirAll(filepath.Dir(dest), 0755)
+			if err == nil {
+				err = a.do(path, dest)
+			}
+			if err != nil {
+				summary.fail(path, err)
+				continue
+			}
+		}
+		summary.change(path, []string{"-> " + dest})
+	}
+	summary.print(stats.Total, fmt.Sprintf("%v found", stats.Found))
+}
+
+// relPath returns path relative to the root in roots, in which it is.
+// If it's in no root, e.g. it's read from stdin, its base name is returned.
+func relPath(roots []string, path string) string {
+	for _, root := range roots {
+		if root == "-" {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return rel
+	}
+	return filepath.Base(path)
+}
+
+// isCopy reports whether dest is a copy of src made by copyFile,
+// i.e. it has the same size and modification time.
+func isCopy(src, dest string) bool {
+	a, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(dest)
+	if err != nil {
+		return false
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
@@ -0,0 +1,472 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// artCommands are subcommands of "tagrep art".
+var artCommands = []string{"extract", "embed"}
+
+// artTemplateFields are fields, which can be used in --template
+// of "tagrep art extract".
+var artTemplateFields = append([]string{"ext"}, templateFields...)
+
+// runArt runs "tagrep art" command with args.
+func runArt(args []string) {
+	flags := artFlags()
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("ERROR: enter art command")
+		flags.Usage()
+		os.Exit(1)
+	}
+	paths := flags.Args()[1:]
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	switch flags.Arg(0) {
+	case "extract":
+		runArtExtract(paths)
+	case "embed":
+		runArtEmbed(paths)
+	default:
+		fmt.Println("ERROR: unknown art command", flags.Arg(0))
+		flags.Usage()
+		os.Exit(1)
+	}
+}
+
+// picture is an attached picture extracted from file.
+type picture struct {
+	data []byte
+	// dest is a path, to which picture is written.
+	dest string
+	// album identifies album of file for --largest.
+	album string
+}
+
+// runArtExtract runs "tagrep art extract" command with paths.
+func runArtExtract(paths []string) {
+	if err := checkTemplate(flagTemplate, artTemplateFields); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	t := time.Now()
+	files, stats := walkFiles(paths)
+
+	// taken are hashes of pictures keyed by paths, to which they're written.
+	taken := make(map[string][sha256.Size]byte)
+	var written int
+	write := func(path string, p picture) {
+		dest, ok, err := writePicture(p.dest, p.data, taken, flagDryRun)
+		if err != nil {
+			if logFileError(path, err) {
+				os.Exit(errorStatus)
+			}
+			return
+		}
+		if ok {
+			written++
+			fmt.Println(path, "->", dest)
+		} else if flagVerbose {
+			fmt.Println(path, "->", dest, "(already extracted)")
+		}
+	}
+
+	// With --largest, the largest picture of album is written
+	// after all files are read.
+	largest := make(map[string]picture)
+	largestPaths := make(map[string]string)
+	for _, path := range files {
+		pictures, err := readPictures(path)
+		if err != nil {
+			if logFileError(path, err) {
+				os.Exit(errorStatus)
+			}
+			continue
+		}
+		for _, p := range pictures {
+			if !flagLargest {
+				write(path, p)
+				continue
+			}
+			if l, ok := largest[p.album]; !ok || len(p.data) > len(l.data) {
+				largest[p.album] = p
+				largestPaths[p.album] = path
+			}
+		}
+	}
+	albums := make([]string, 0, len(largest))
+	for album := range largest {
+		albums = append(albums, album)
+	}
+	sort.Strings(albums)
+	for _, album := range albums {
+		write(largestPaths[album], largest[album])
+	}
+
+	expired := time.Since(t)
+	verb := "extracted"
+	if flagDryRun {
+		verb = "would be extracted"
+	}
+	fmt.Printf("%v files total, %v pictures %v in %vms\n", stats.Total, written, verb, int(1000*expired.Seconds()))
+	checkScanErrors(stats)
+}
+
+// folderImages are names of images, which are embedded with
+// --from-folder, in order of preference.
+var folderImages = []string{"cover.jpg", "cover.jpeg", "cover.png", "folder.jpg", "folder.jpeg", "folder.png", "front.jpg", "front.png"}
+
+// coverImage is a picture read from file to embed.
+type coverImage struct {
+	path     string
+	data     []byte
+	mimeType string
+}
+
+// runArtEmbed runs "tagrep art embed" command with paths.
+func runArtEmbed(paths []string) {
+	if (flagImage == "") == !flagFromFolder {
+		fmt.Println("ERROR: enter either --image or --from-folder")
+		os.Exit(1)
+	}
+	var given *coverImage
+	if flagImage != "" {
+		var err error
+		given, err = readImage(flagImage)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+	}
+
+	summary := newChangeSummary()
+	files, stats := walkFiles(paths)
+
+	// folders are images of directories for --from-folder.
+	// Directories without images have nil.
+	folders := make(map[string]*coverImage)
+	for _, path := range files {
+		img := given
+		if flagFromFolder {
+			dir := filepath.Dir(path)
+			var ok bool
+			if img, ok = folders[dir]; !ok {
+				var err error
+				img, err = findFolderImage(dir)
+				if err != nil {
+					if logFileError(dir, err) {
+						os.Exit(errorStatus)
+					}
+				}
+				folders[dir] = img
+			}
+			if img == nil {
+				if flagVerbose {
+					fmt.Println(path, "(no image in folder)")
+				}
+				summary.change(path, nil)
+				continue
+			}
+		}
+
+		ok, err := embedPicture(path, img, flagDryRun)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		if !ok {
+			if flagVerbose {
+				fmt.Println(path, "(already has picture)")
+			}
+			summary.change(path, nil)
+			continue
+		}
+		summary.change(path, []string{fmt.Sprintf("APIC: %v, %v, %v bytes", img.path, img.mimeType, len(img.data))})
+	}
+	summary.print(stats.Total)
+	checkScanErrors(stats)
+}
+
+// findFolderImage returns the first of folderImages in dir.
+// If there is no one, it returns nil.
+func findFolderImage(dir string) (*coverImage, error) {
+	for _, name := range folderImages {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		return readImage(path)
+	}
+	return nil, nil
+}
+
+// readImage reads image in path and checks, that it's JPEG or PNG
+// not larger than --max-size.
+func readImage(path string) (*coverImage, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > flagMaxSize {
+		return nil, fmt.Errorf("%v is %v bytes, larger than --max-size %v", path, fi.Size(), flagMaxSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var decodeConfig func(io.Reader) (image.Config, error)
+	mimeType := http.DetectContentType(data)
+	switch mimeType {
+	case "image/jpeg":
+		decodeConfig = jpeg.DecodeConfig
+	case "image/png":
+		decodeConfig = png.DecodeConfig
+	default:
+		return nil, fmt.Errorf("%v is %v, not JPEG or PNG", path, mimeType)
+	}
+	if _, err := decodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%v is invalid image: %v", path, err)
+	}
+	return &coverImage{path: path, data: data, mimeType: mimeType}, nil
+}
+
+// embedPicture adds img as front cover to file in path, if file has
+// no attached pictures. It returns whether picture is added.
+// If dryRun is set, file is not written.
+func embedPicture(path string, img *coverImage, dryRun bool) (bool, error) {
+	if err := checkRewritable(path); err != nil {
+		return false, err
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return false, err
+	}
+	defer tag.Close()
+
+	if len(tag.GetFrames("APIC")) > 0 {
+		return false, nil
+	}
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    tag.DefaultEncoding(),
+		MimeType:    img.mimeType,
+		PictureType: id3v2.PTFrontCover,
+		Description: "Front cover",
+		Picture:     img.data,
+	})
+	if dryRun {
+		return true, nil
+	}
+	return true, tag.Save()
+}
+
+// walkFiles returns sorted paths of files in paths matching query
+// of flags added by addQueryFlags. If query is empty, all files
+// are returned.
+func walkFiles(paths []string) ([]string, tagrep.Stats) {
+	s := newScanner()
+	s.Recursive = flagRecursive
+	query := flagQuery()
+	// Walk also reads frames needed by matchers of query.
+	s.Query = query
+
+	var mu sync.Mutex
+	var files []string
+	stats, err := s.Walk(context.Background(), paths, func(r tagrep.Result) {
+		if !query.IsEmpty() && !query.Match(r.Frames) {
+			return
+		}
+		mu.Lock()
+		files = append(files, r.Path)
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+	sort.Strings(files)
+	return files, stats
+}
+
+// readPictures returns attached pictures of file in path with their
+// destinations built by --template.
+func readPictures(path string) ([]picture, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true, ParseFrames: append([]string{"APIC"}, templateFrames...)})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	fields := tagTemplateFields(tag)
+	album := path
+	if fields["album"] != "" {
+		artist := fields["albumartist"]
+		if artist == "" {
+			artist = fields["artist"]
+		}
+		album = normalizeTag(artist) + "\x00" + normalizeTag(fields["album"])
+	}
+
+	var pictures []picture
+	for _, f := range tag.GetFrames("APIC") {
+		pf, ok := f.(id3v2.PictureFrame)
+		if !ok || len(pf.Picture) == 0 {
+			continue
+		}
+		fields["ext"] = pictureExt(pf)
+		dest, err := expandTemplate(flagTemplate, fields)
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(flagDest, dest)
+		}
+		pictures = append(pictures, picture{data: pf.Picture, dest: dest, album: album})
+	}
+	return pictures, nil
+}
+
+// pictureExt returns extension of file for picture of pf without dot.
+// Type of picture is detected by its content, because MIME types
+// in frames are often wrong.
+func pictureExt(pf id3v2.PictureFrame) string {
+	mimeType := http.DetectContentType(pf.Picture)
+	if mimeType == "application/octet-stream" {
+		mimeType = pf.MimeType
+	}
+	switch mimeType {
+	case "image/jpeg", "image/jpg":
+		return "jpg"
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	case "image/bmp":
+		return "bmp"
+	}
+	return "bin"
+}
+
+// writePicture writes data to path, if it's not written there yet.
+// If there is another file in path or it's taken by another picture,
+// number is added to name like by freePath. It returns path, to which
+// data is written, and whether it's new. Written pictures are recorded
+// in taken, so pictures aren't written twice with dryRun too.
+func writePicture(path string, data []byte, taken map[string][sha256.Size]byte, dryRun bool) (string, bool, error) {
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		if h, ok := taken[path]; ok {
+			if h == sum {
+				return path, false, nil
+			}
+		} else {
+			existing, err := os.ReadFile(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			if err != nil {
+				return "", false, err
+			}
+			if bytes.Equal(existing, data) {
+				taken[path] = sum
+				return path, false, nil
+			}
+		}
+		path = fmt.Sprintf("%v (%v)%v", base, i, ext)
+	}
+
+	taken[path] = sum
+	if dryRun {
+		return path, true, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", false, err
+	}
+	return path, true, os.WriteFile(path, data, 0644)
+}
+
+// artFlags returns flags of "tagrep art" command.
+func artFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("art", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep art extract [flags] paths
+  tagrep art embed --image FILE [flags] paths
+  tagrep art embed --from-folder [flags] paths
+
+"tagrep art extract" writes attached pictures of files to paths built
+by --template. Fields of template are {%v}.
+Identical pictures are written once. If another file with the same
+name exists, number is added to name: "cover (2).jpg". For example:
+
+  tagrep art extract -r --largest --dest ~/covers --template "{artist} - {album}.{ext}" /music
+
+"tagrep art embed" adds front cover to files, which have no attached
+pictures. Image is --image or, with --from-folder, the first of %v
+in directory of file. Image must be JPEG or PNG not larger than
+--max-size:
+
+  tagrep art embed -r --from-folder /music
+
+Frames flags restrict files, which are processed. If no frames are
+given, all files are processed.
+
+Flags:
+`, strings.Join(artTemplateFields, "}, {"), strings.Join(folderImages, ", "))
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	flags.StringVar(&flagDest, "dest", ".", "directory, to which relative template is resolved")
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.BoolVar(&flagFromFolder, "from-folder", false, "embed image from directory of every file")
+	flags.StringVar(&flagImage, "image", "", "path of image to embed")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVar(&flagLargest, "largest", false, "extract only the largest picture of every album")
+	flags.Int64Var(&flagMaxSize, "max-size", 1<<20, "maximum size of image to embed in bytes")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.StringVar(&flagTemplate, "template", "{artist}/{album}/cover.{ext}", "template of paths of pictures")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output: also print pictures, which are already extracted, and skipped files")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,294 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// audioInfo describes MPEG audio of file.
+type audioInfo struct {
+	Duration time.Duration
+	// Bitrate is an average bitrate in kbit/s.
+	Bitrate int
+	// Hash is a SHA-256 of audio data without tags,
+	// if it's requested.
+	Hash string
+}
+
+// maxSyncSearch is the maximal number of bytes after ID3v2 tag,
+// in which the first MPEG frame is searched.
+const maxSyncSearch = 64 * 1024
+
+var errNoAudio = errors.New("no MPEG audio frames found")
+
+// readAudioInfo reads MPEG audio info of file in path. If hash is set,
+// audio data between ID3v2 and ID3v1 tags is hashed, so files with the
+// same audio and different tags have the same hash.
+func readAudioInfo(path string, hash bool) (audioInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return audioInfo{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return audioInfo{}, err
+	}
+	start, err := id3v2End(f)
+	if err != nil {
+		return audioInfo{}, err
+	}
+	end, err := id3v1Start(f, fi.Size())
+	if err != nil {
+		return audioInfo{}, err
+	}
+
+	buf := make([]byte, maxSyncSearch+maxFrameSize)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return audioInfo{}, err
+	}
+	buf = buf[:n]
+
+	offset, h := findFrame(buf)
+	if offset < 0 {
+		return audioInfo{}, errNoAudio
+	}
+	start += int64(offset)
+	if start >= end {
+		return audioInfo{}, errNoAudio
+	}
+
+	info := audioInfo{}
+	size := end - start
+	if frames := vbrFrames(buf[offset:], h); frames > 0 {
+		// The first frame is the VBR header without audio.
+		size -= int64(h.length())
+		seconds := float64(frames) * float64(h.samples()) / float64(h.sampleRate)
+		info.Duration = time.Duration(seconds * float64(time.Second))
+		if seconds > 0 {
+			info.Bitrate = int(float64(size) * 8 / seconds / 1000)
+		}
+	} else {
+		info.Bitrate = h.bitrate
+		info.Duration = time.Duration(float64(size) * 8 / float64(h.bitrate*1000) * float64(time.Second))
+	}
+
+	if hash {
+		sum := sha256.New()
+		if _, err := io.Copy(sum, bufio.NewReader(io.NewSectionReader(f, start, end-start))); err != nil {
+			return audioInfo{}, err
+		}
+		info.Hash = hex.EncodeToString(sum.Sum(nil))
+	}
+
+	return info, nil
+}
+
+// id3v2End returns offset of the first byte after ID3v2 tag in rs
+// or 0, if there is no tag.
+func id3v2End(r io.ReaderAt) (int64, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0, nil
+	}
+
+	end := 10 + synchsafe(header[6:10])
+	if header[5]&0x10 != 0 {
+		// Footer.
+		end += 10
+	}
+	return end, nil
+}
+
+// id3v1Start returns offset of ID3v1 tag at the end of r
+// or size, if there is no tag.
+func id3v1Start(r io.ReaderAt, size int64) (int64, error) {
+	if size < 128 {
+		return size, nil
+	}
+	marker := make([]byte, 3)
+	if _, err := r.ReadAt(marker, size-128); err != nil {
+		return 0, err
+	}
+	if bytes.Equal(marker, []byte("TAG")) {
+		return size - 128, nil
+	}
+	return size, nil
+}
+
+// synchsafe returns synchsafe integer in b, in which
+// the most significant bit of every byte is zero.
+func synchsafe(b []byte) int64 {
+	var n int64
+	for _, c := range b {
+		n = n<<7 | int64(c&0x7f)
+	}
+	return n
+}
+
+// maxFrameSize is the maximal size of MPEG audio frame.
+const maxFrameSize = 2881
+
+// mpegHeader is a parsed header of MPEG audio frame.
+type mpegHeader struct {
+	version    int // 1, 2 or 25 for MPEG 2.5.
+	layer      int
+	bitrate    int // kbit/s.
+	sampleRate int
+	padding    bool
+	mono       bool
+}
+
+var (
+	// Bitrates keyed by MPEG version 1 or 2 and layer.
+	bitrates = map[[2]int][16]int{
+		{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+
+	// Sample rates of MPEG 1. They're halved for MPEG 2
+	// and quartered for MPEG 2.5.
+	sampleRates = [3]int{44100, 48000, 32000}
+)
+
+// parseMPEGHeader parses header of MPEG audio frame in b.
+func parseMPEGHeader(b []byte) (mpegHeader, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mpegHeader{}, false
+	}
+
+	var h mpegHeader
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		h.version = 25
+	case 2:
+		h.version = 2
+	case 3:
+		h.version = 1
+	default:
+		return mpegHeader{}, false
+	}
+	h.layer = 4 - int((b[1]>>1)&3)
+	if h.layer == 4 {
+		return mpegHeader{}, false
+	}
+
+	brIndex, srIndex := b[2]>>4, (b[2]>>2)&3
+	if brIndex == 0 || brIndex == 15 || srIndex == 3 {
+		// Free format bitrates are not supported.
+		return mpegHeader{}, false
+	}
+	table := 1
+	if h.version != 1 {
+		table = 2
+	}
+	h.bitrate = bitrates[[2]int{table, h.layer}][brIndex]
+	h.sampleRate = sampleRates[srIndex]
+	switch h.version {
+	case 2:
+		h.sampleRate /= 2
+	case 25:
+		h.sampleRate /= 4
+	}
+	h.padding = (b[2]>>1)&1 == 1
+	h.mono = b[3]>>6 == 3
+	return h, true
+}
+
+// samples returns number of samples in frame.
+func (h mpegHeader) samples() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+// length returns length of frame in bytes.
+func (h mpegHeader) length() int {
+	padding := 0
+	if h.padding {
+		padding = 1
+	}
+	if h.layer == 1 {
+		return (12*h.bitrate*1000/h.sampleRate + padding) * 4
+	}
+	return h.samples()/8*h.bitrate*1000/h.sampleRate + padding
+}
+
+// findFrame returns offset and header of the first MPEG frame in b
+// or -1, if it's not found. Frame is accepted only if it's followed
+// by another frame or by the end of b, so random bytes like sync
+// aren't taken as frame.
+func findFrame(b []byte) (int, mpegHeader) {
+	for i := 0; i+4 <= len(b) && i < maxSyncSearch; i++ {
+		h, ok := parseMPEGHeader(b[i:])
+		if !ok {
+			continue
+		}
+		next := i + h.length()
+		if next+4 > len(b) {
+			if next >= len(b) {
+				return i, h
+			}
+			continue
+		}
+		if _, ok := parseMPEGHeader(b[next:]); ok {
+			return i, h
+		}
+	}
+	return -1, mpegHeader{}
+}
+
+// vbrFrames returns number of frames from Xing or VBRI header
+// in the first frame b with header h or 0, if there is no such header.
+func vbrFrames(b []byte, h mpegHeader) int {
+	// Xing header follows side information of Layer III.
+	offset := 4 + 32
+	switch {
+	case h.version == 1 && h.mono:
+		offset = 4 + 17
+	case h.version != 1 && !h.mono:
+		offset = 4 + 17
+	case h.version != 1 && h.mono:
+		offset = 4 + 9
+	}
+	if len(b) >= offset+12 {
+		id := string(b[offset : offset+4])
+		flags := binary.BigEndian.Uint32(b[offset+4:])
+		if (id == "Xing" || id == "Info") && flags&1 != 0 {
+			return int(binary.BigEndian.Uint32(b[offset+8:]))
+		}
+	}
+
+	// VBRI header is always 32 bytes after header.
+	if len(b) >= 4+32+18 && string(b[36:40]) == "VBRI" {
+		return int(binary.BigEndian.Uint32(b[36+14:]))
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// changeSummary prints changes of files made by commands, which write
+// files, and counts them for the summary. Every changed file is printed
+// as its path followed by indented changes.
+type changeSummary struct {
+	start                               time.Time
+	changed, unchanged, failed, skipped int
+}
+
+func newChangeSummary() *changeSummary {
+	return &changeSummary{start: time.Now()}
+}
+
+// change prints changes of file in path. If there are no changes,
+// file is counted as unchanged.
+func (s *changeSummary) change(path string, changes []string) {
+	if len(changes) == 0 {
+		s.unchanged++
+		return
+	}
+	s.changed++
+	fmt.Println(path)
+	for _, c := range changes {
+		fmt.Println("  " + c)
+	}
+}
+
+// fail logs err of file in path. Files with errUnsupportedTag
+// are counted as skipped with warning.
+func (s *changeSummary) fail(path string, err error) {
+	if errors.Is(err, errUnsupportedTag) {
+		s.skipped++
+		slog.Warn("file is skipped", "path", path, "err", err)
+		return
+	}
+	s.failed++
+	if logFileError(path, err) {
+		os.Exit(errorStatus)
+	}
+}
+
+// print prints summary of total files with details, e.g.
+// "10 files total, 2 changed, 7 unchanged, 1 failed in 5ms".
+// With --dry-run, changed files are "would be changed".
+func (s *changeSummary) print(total int64, details ...string) {
+	verb := "changed"
+	if flagDryRun {
+		verb = "would be changed"
+	}
+	fmt.Printf("%v files total, %v %v, %v unchanged, %v failed", total, s.changed, verb, s.unchanged, s.failed)
+	if s.skipped > 0 {
+		fmt.Printf(", %v skipped", s.skipped)
+	}
+	for _, d := range details {
+		fmt.Print(", ", d)
+	}
+	fmt.Printf(" in %vms\n", int(1000*time.Since(s.start).Seconds()))
+}
+
+// addDryRunFlag adds --dry-run to flags of command, which writes files.
+func addDryRunFlag(flags *pflag.FlagSet) {
+	flags.BoolVarP(&flagDryRun, "dry-run", "n", false, "only print changes without writing files")
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// shells are shells supported by "tagrep completion".
+var shells = []string{"bash", "zsh", "fish"}
+
+// completionFlags returns flags of "tagrep completion" command.
+func completionFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("completion", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep completion bash|zsh|fish
+
+Prints completion script for given shell. For example:
+
+  source <(tagrep completion bash)
+  tagrep completion zsh > "${fpath[1]}/_tagrep"
+  tagrep completion fish > ~/.config/fish/completions/tagrep.fish
+
+Scripts call tagrep to complete commands, flags and their values,
+so they don't need to be regenerated after updates.
+`)
+	}
+	return flags
+}
+
+// runCompletion runs "tagrep completion" command with args.
+func runCompletion(args []string) {
+	flags := completionFlags()
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("ERROR: enter shell")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	switch flags.Arg(0) {
+	case "bash":
+		os.Stdout.WriteString(bashCompletion)
+	case "zsh":
+		os.Stdout.WriteString(zshCompletion)
+	case "fish":
+		os.Stdout.WriteString(fishCompletion)
+	default:
+		fmt.Println("ERROR: unknown shell", flags.Arg(0))
+		os.Exit(1)
+	}
+}
+
+const bashCompletion = `# bash completion for tagrep
+
+_tagrep() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	local IFS=$'\n'
+	COMPREPLY=($(tagrep __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+	if [ ${#COMPREPLY[@]} -eq 0 ]; then
+		COMPREPLY=($(compgen -f -- "$cur"))
+	fi
+}
+
+complete -o filenames -F _tagrep tagrep
+`
+
+const zshCompletion = `#compdef tagrep
+# zsh completion for tagrep
+
+_tagrep() {
+	local -a candidates
+	candidates=(${(f)"$(tagrep __complete "${(@)words[2,$CURRENT]}" 2>/dev/null)"})
+	if (( ${#candidates} )); then
+		compadd -- $candidates
+	else
+		_files
+	fi
+}
+
+if [ "$funcstack[1]" = "_tagrep" ]; then
+	_tagrep "$@"
+else
+	compdef _tagrep tagrep
+fi
+`
+
+const fishCompletion = `# fish completion for tagrep
+
+function __tagrep_complete
+	set -l args (commandline -opc)[2..-1] (commandline -ct)
+	set -l candidates (tagrep __complete $args 2>/dev/null)
+	if test (count $candidates) -gt 0
+		printf '%s\n' $candidates
+	else
+		__fish_complete_path (commandline -ct)
+	end
+end
+
+complete -c tagrep -f -a '(__tagrep_complete)'
+`
+
+// flagValues are completions of flag values keyed by flag names.
+// Flags, which aren't there, are completed with files.
+var flagValues = map[string][]string{
+	"color":      {"auto", "always", "never"},
+	"disable":    lintCodes,
+	"exts":       {".mp3", ".aiff", ".wav", "*"},
+	"format":     {"path", "json"},
+	"log-format": {"text", "json"},
+	"log-level":  {"debug", "info", "warn", "error"},
+	"frames":     {"APIC", "COMM", "GEOB", "POPM", "PRIV", "TXXX", "UFID", "USLT", "WXXX"},
+	"match":      tagrep.Matchers(),
+	"on-error":   {"skip", "warn", "fail"},
+	"play":       {"mpv", "vlc", "mpd"},
+	"profile":    {"cpu", "mem", "trace"},
+}
+
+// runComplete prints completions of the last word in words
+// of command line without "tagrep". It's called by completion scripts.
+// If nothing is printed, scripts complete files.
+func runComplete(words []string) {
+	for _, c := range complete(words) {
+		fmt.Println(c)
+	}
+}
+
+// complete returns completions of the last word in words.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := words[:len(words)-1]
+
+	cmd := findCommand("search")
+	args := prev
+	if len(prev) > 0 {
+		if c := findCommand(prev[0]); c != nil {
+			cmd, args = c, prev[1:]
+		}
+	}
+	flags := cmd.flags()
+	addLogFlags(flags)
+
+	// Value of flag separated by "=", which bash passes as separate word.
+	if len(args) >= 2 && args[len(args)-1] == "=" {
+		return completeValue(flags, args[len(args)-2], "", cur)
+	}
+
+	// Value of flag in the same word: --exts=.mp3.
+	if strings.HasPrefix(cur, "--") && strings.Contains(cur, "=") {
+		i := strings.Index(cur, "=")
+		return completeValue(flags, cur[:i], cur[:i+1], cur[i+1:])
+	}
+
+	// Value of flag in the next word: --exts .mp3.
+	if len(args) > 0 {
+		if f := lookupFlag(flags, args[len(args)-1]); f != nil && f.NoOptDefVal == "" {
+			return completeValue(flags, args[len(args)-1], "", cur)
+		}
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		return completeFlags(flags, cur)
+	}
+
+	var candidates []string
+	if len(prev) == 0 {
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	} else if len(args) == 0 {
+		candidates = cmd.args
+	}
+	return filterPrefix(candidates, cur)
+}
+
+// lookupFlag returns flag in flags by its name with dashes
+// (e.g. "--exts" or "-e") or nil, if there is no such flag.
+func lookupFlag(flags *pflag.FlagSet, name string) *pflag.Flag {
+	switch {
+	case strings.HasPrefix(name, "--"):
+		return flags.Lookup(name[2:])
+	case strings.HasPrefix(name, "-") && len(name) == 2:
+		return flags.ShorthandLookup(name[1:])
+	}
+	return nil
+}
+
+// completeValue returns completions of value cur of flag with name.
+// Completions are prefixed by prefix. Comma-separated values of
+// slice flags are completed by their last element.
+func completeValue(flags *pflag.FlagSet, name, prefix, cur string) []string {
+	f := lookupFlag(flags, name)
+	if f == nil {
+		return nil
+	}
+	values := flagValues[f.Name]
+	if f.Name == "preset" {
+		loadConfig()
+		values = presetNames()
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if i := strings.LastIndex(cur, ","); i >= 0 && strings.HasSuffix(f.Value.Type(), "Slice") {
+		prefix += cur[:i+1]
+		cur = cur[i+1:]
+	}
+
+	var candidates []string
+	for _, v := range filterPrefix(values, cur) {
+		candidates = append(candidates, prefix+v)
+	}
+	return candidates
+}
+
+// completeFlags returns flags in flags starting with cur.
+func completeFlags(flags *pflag.FlagSet, cur string) []string {
+	var candidates []string
+	flags.VisitAll(func(f *pflag.Flag) {
+		candidates = append(candidates, "--"+f.Name)
+		if f.Shorthand != "" && !strings.HasPrefix(cur, "--") {
+			candidates = append(candidates, "-"+f.Shorthand)
+		}
+	})
+	return filterPrefix(candidates, cur)
+}
+
+// filterPrefix returns elements of candidates starting with prefix.
+func filterPrefix(candidates []string, prefix string) []string {
+	var filtered []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,252 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+)
+
+// config is a content of config file. Keys are names of flags, values
+// are their defaults (e.g. exts = [".mp3", ".flac"]). Key "paths" sets
+// paths used, when no paths are given in command line.
+//
+// Table "presets" contains named sets of flags with the same keys,
+// which are selected by --preset:
+//
+//	[presets.queen-70s]
+//	artist = "Queen"
+//	year = "1975"
+var config map[string]interface{}
+
+// preset is a preset selected by --preset.
+var preset map[string]interface{}
+
+// configPath returns path of config file, which is TAGREP_CONFIG
+// or tagrep/config.toml in user's config directory.
+func configPath() string {
+	if path := os.Getenv("TAGREP_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tagrep", "config.toml")
+}
+
+// loadConfig reads config file to config.
+// If there is no config file, config stays empty.
+func loadConfig() {
+	config = make(map[string]interface{})
+
+	path := configPath()
+	if path == "" {
+		return
+	}
+	_, err := toml.DecodeFile(path, &config)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		fmt.Println("ERROR: can't read config:", err)
+		os.Exit(errorStatus)
+	}
+
+	for key := range config {
+		if key == "presets" {
+			continue
+		}
+		if !isConfigKey(key) {
+			fmt.Printf("ERROR: unknown key %q in config %v\n", key, path)
+			os.Exit(errorStatus)
+		}
+	}
+
+	if _, ok := config["presets"]; ok && presets() == nil {
+		fmt.Printf("ERROR: presets in config %v must be a table\n", path)
+		os.Exit(errorStatus)
+	}
+	for name, p := range presets() {
+		p, ok := p.(map[string]interface{})
+		if !ok {
+			fmt.Printf("ERROR: preset %q in config %v must be a table\n", name, path)
+			os.Exit(errorStatus)
+		}
+		for key := range p {
+			if key == "preset" || !isConfigKey(key) {
+				fmt.Printf("ERROR: unknown key %q in preset %q in config %v\n", key, name, path)
+				os.Exit(errorStatus)
+			}
+		}
+	}
+}
+
+// presets returns presets from config file keyed by their names.
+func presets() map[string]interface{} {
+	p, _ := config["presets"].(map[string]interface{})
+	return p
+}
+
+// presetNames returns sorted names of presets.
+func presetNames() []string {
+	var names []string
+	for name := range presets() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isConfigKey reports whether key can be set in config file.
+func isConfigKey(key string) bool {
+	if key == "paths" {
+		return true
+	}
+	for _, cmd := range commands {
+		flags := cmd.flags()
+		addLogFlags(flags)
+		if flags.Lookup(key) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// noConfig is an annotation of flags, which are set only in command line.
+const noConfig = "tagrep-no-config"
+
+// parseFlags parses args with flags. Flags, which are not given in args,
+// are set from preset selected by --preset, from environment variables
+// and then from config file, which must be loaded by loadConfig.
+// Flags annotated by noConfig are not set from them.
+func parseFlags(flags *pflag.FlagSet, args []string) {
+	addLogFlags(flags)
+	flags.Parse(args)
+
+	if f := flags.Lookup("preset"); f != nil && f.Value.String() != "" {
+		name := f.Value.String()
+		p, ok := presets()[name].(map[string]interface{})
+		if !ok {
+			fmt.Printf("ERROR: unknown preset %q\n", name)
+			os.Exit(errorStatus)
+		}
+		preset = p
+		setFlags(flags, p, fmt.Sprintf("preset %q", name))
+	}
+
+	// Flags set from presets and environment become changed,
+	// so config doesn't override them.
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Annotations[noConfig] != nil {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			fmt.Printf("ERROR: invalid value of %v: %v\n", name, err)
+			os.Exit(errorStatus)
+		}
+	})
+
+	setFlags(flags, config, "config")
+	initLogging()
+}
+
+// setFlags sets flags, which are not changed yet, from values
+// keyed by names of flags. source is used in errors.
+func setFlags(flags *pflag.FlagSet, values map[string]interface{}, source string) {
+	// Set in stable order, so errors are reproducible.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := flags.Lookup(key)
+		if f == nil || f.Changed || f.Annotations[noConfig] != nil {
+			continue
+		}
+		if err := flags.Set(key, configValue(values[key])); err != nil {
+			fmt.Printf("ERROR: invalid value of %q in %v: %v\n", key, source, err)
+			os.Exit(errorStatus)
+		}
+	}
+}
+
+// configValue converts value from config file to flag value.
+// Arrays are converted to comma-separated lists.
+func configValue(v interface{}) string {
+	if a, ok := v.([]interface{}); ok {
+		values := make([]string, len(a))
+		for i, v := range a {
+			values[i] = fmt.Sprint(v)
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// envName returns name of environment variable for flag with name
+// (e.g. TAGREP_FILE_TIMEOUT for "file-timeout").
+func envName(name string) string {
+	return "TAGREP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// defaultPaths returns paths from preset, TAGREP_PATHS or config file.
+// They're used, when no paths are given in command line.
+// Paths in TAGREP_PATHS are separated like in PATH.
+func defaultPaths() []string {
+	if paths := configPaths(preset); len(paths) > 0 {
+		return paths
+	}
+	if env := os.Getenv("TAGREP_PATHS"); env != "" {
+		return filepath.SplitList(env)
+	}
+	return configPaths(config)
+}
+
+// configPaths returns "paths" from values.
+func configPaths(values map[string]interface{}) []string {
+	a, ok := values["paths"].([]interface{})
+	if !ok {
+		if path, ok := values["paths"].(string); ok {
+			return []string{expandHome(path)}
+		}
+		return nil
+	}
+
+	var paths []string
+	for _, v := range a {
+		if path, ok := v.(string); ok {
+			paths = append(paths, expandHome(path))
+		}
+	}
+	return paths
+}
+
+// expandHome replaces leading "~" in path with user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// dateFrame is a timestamp frame of ID3v2.4 matched by --NAME-after,
+// --NAME-before and --NAME-within.
+type dateFrame struct {
+	name        string
+	description string
+	help        string
+}
+
+// dateFrames are timestamp frames, which can be matched.
+var dateFrames = []dateFrame{
+	{"released", "Release time", "release date (TDRL)"},
+	{"encoded", "Encoding time", "encoding date (TDEN)"},
+	{"tagged", "Tagging time", "tagging date (TDTG)"},
+}
+
+// flagDates are values of flags of dateFrames keyed by names of flags.
+var flagDates = make(map[string]*string)
+
+// addDateFlags adds flags of dateFrames to flags.
+func addDateFlags(flags *pflag.FlagSet) {
+	for _, f := range dateFrames {
+		for _, kind := range []string{"after", "before", "within"} {
+			name := f.name + "-" + kind
+			v := new(string)
+			flagDates[name] = v
+			var usage string
+			switch kind {
+			case "after":
+				usage = "match files with " + f.help + " at or after given date (e.g. 2020-06) or time ago (e.g. 30d)"
+			case "before":
+				usage = "match files with " + f.help + " before given date or time ago"
+			case "within":
+				usage = "match files with " + f.help + " within given time ago (e.g. 12h, 30d, 2w, 6m or 1y)"
+			}
+			flags.StringVar(v, name, "", usage)
+		}
+	}
+}
+
+// dateMatchers returns matchers of flags of dateFrames.
+func dateMatchers() []tagrep.Matcher {
+	now := time.Now().UTC()
+	var matchers []tagrep.Matcher
+	for _, f := range dateFrames {
+		m := dateMatcher{description: f.description}
+		for _, kind := range []string{"after", "before", "within"} {
+			name := f.name + "-" + kind
+			v := flagDates[name]
+			if v == nil || *v == "" {
+				continue
+			}
+			t, err := parseDate(*v, now, kind == "within")
+			if err != nil {
+				fmt.Printf("ERROR: invalid --%v %q: %v\n", name, *v, err)
+				os.Exit(errorStatus)
+			}
+			if kind == "before" {
+				m.before = t
+			} else if m.after.IsZero() || t.After(m.after) {
+				m.after = t
+			}
+		}
+		if !m.after.IsZero() || !m.before.IsZero() {
+			matchers = append(matchers, m)
+		}
+	}
+	return matchers
+}
+
+// dateFlagValues returns non-empty values of flags of dateFrames
+// as NAME=VALUE.
+func dateFlagValues() []string {
+	var values []string
+	for _, f := range dateFrames {
+		for _, kind := range []string{"after", "before", "within"} {
+			name := f.name + "-" + kind
+			if v := flagDates[name]; v != nil && *v != "" {
+				values = append(values, name+"="+*v)
+			}
+		}
+	}
+	return values
+}
+
+// dateMatcher matches files with timestamp in frame with description
+// at or after after and before before. Zero times are not matched.
+type dateMatcher struct {
+	description   string
+	after, before time.Time
+}
+
+func (m dateMatcher) Frames() []string { return []string{m.description} }
+
+func (m dateMatcher) Match(frames map[string]string) bool {
+	for _, v := range tagrep.Values(frames[m.description]) {
+		t, err := parseTimestamp(v)
+		if err != nil {
+			continue
+		}
+		if (m.after.IsZero() || !t.Before(m.after)) && (m.before.IsZero() || t.Before(m.before)) {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeDate is a time ago like "30d".
+var relativeDate = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+
+// parseDate parses s as timestamp or time ago relative to now.
+// If relative is true, only time ago is allowed.
+func parseDate(s string, now time.Time, relative bool) (time.Time, error) {
+	m := relativeDate.FindStringSubmatch(s)
+	if m == nil {
+		if relative {
+			return time.Time{}, errors.New("time ago must be number with unit h, d, w, m or y (e.g. 30d)")
+		}
+		return parseTimestamp(s)
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch m[2] {
+	case "h":
+		return now.Add(-time.Duration(n) * time.Hour), nil
+	case "d":
+		return now.AddDate(0, 0, -n), nil
+	case "w":
+		return now.AddDate(0, 0, -7*n), nil
+	case "m":
+		return now.AddDate(0, -n, 0), nil
+	}
+	return now.AddDate(-n, 0, 0), nil
+}
+
+// timestampLayouts are layouts of timestamps of ID3v2.4 with
+// decreasing precision.
+var timestampLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02T15",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseTimestamp parses timestamp of ID3v2.4 (yyyy[-MM[-dd[THH[:mm[:ss]]]]])
+// in UTC. Date and time may be separated by space too. Partial timestamp
+// is the beginning of its period, e.g. "2020-06" is June 1, 2020.
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.Replace(strings.TrimSpace(s), " ", "T", 1)
+	for _, layout := range timestampLayouts {
+		if len(s) != len(layout) {
+			continue
+		}
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("date must be like 2020, 2020-06, 2020-06-15 or 2020-06-15T12:30:00")
+}
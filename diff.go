@@ -0,0 +1,205 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// track is a file compared by "tagrep diff".
+type track struct {
+	// path is relative to root of tree.
+	path string
+	// frames are texts of frames keyed by IDs.
+	frames map[string][]string
+}
+
+// identity returns normalized artist, album and title of t.
+// Tracks with the same identity are compared by their frames.
+func (t track) identity() string {
+	return normalizeTag(t.frame("TPE1")) + "\x00" + normalizeTag(t.frame("TALB")) + "\x00" + normalizeTag(t.frame("TIT2"))
+}
+
+func (t track) frame(id string) string {
+	if texts := t.frames[id]; len(texts) > 0 {
+		return texts[0]
+	}
+	return ""
+}
+
+// runDiff runs "tagrep diff" command with args.
+func runDiff(args []string) {
+	flags := diffFlags()
+	parseFlags(flags, args)
+
+	if flags.NArg() != 2 {
+		fmt.Println("ERROR: enter two directories")
+		flags.Usage()
+		os.Exit(1)
+	}
+	dirA, dirB := flags.Arg(0), flags.Arg(1)
+
+	t := time.Now()
+	a, stats := readTracks(dirA)
+	b, statsB := readTracks(dirB)
+	stats.Total += statsB.Total
+	stats.Errors += statsB.Errors
+
+	var onlyA, onlyB, differ int
+	for _, key := range unionKeys(a, b) {
+		ta, tb := a[key], b[key]
+		// Tracks with the same identity are paired in order of paths.
+		for len(ta) > 0 && len(tb) > 0 {
+			if lines := frameDiffs(ta[0], tb[0]); len(lines) > 0 {
+				differ++
+				fmt.Printf("differ: %v, %v\n", filepath.Join(dirA, ta[0].path), filepath.Join(dirB, tb[0].path))
+				for _, line := range lines {
+					fmt.Println("  " + line)
+				}
+			}
+			ta, tb = ta[1:], tb[1:]
+		}
+		for _, tr := range ta {
+			onlyA++
+			fmt.Printf("only in %v: %v\n", dirA, tr.path)
+		}
+		for _, tr := range tb {
+			onlyB++
+			fmt.Printf("only in %v: %v\n", dirB, tr.path)
+		}
+	}
+
+	expired := time.Since(t)
+	fmt.Printf("%v files total, %v only in %v, %v only in %v, %v differ in %vms\n",
+		stats.Total, onlyA, dirA, onlyB, dirB, differ, int(1000*expired.Seconds()))
+	checkScanErrors(stats)
+
+	if onlyA > 0 || onlyB > 0 || differ > 0 {
+		os.Exit(1)
+	}
+}
+
+// readTracks reads tracks in dir recursively and returns them keyed by
+// their identities. Tracks with the same identity are sorted by paths.
+// Files without artist, album and title are skipped.
+func readTracks(dir string) (map[string][]track, tagrep.Stats) {
+	s := newScanner()
+	s.Recursive = true
+
+	var mu sync.Mutex
+	tracks := make(map[string][]track)
+	stats, err := s.Walk(context.Background(), []string{dir}, func(r tagrep.Result) {
+		lines, err := readFrameLines(r.Path)
+		if err != nil {
+			if logFileError(r.Path, err) {
+				os.Exit(errorStatus)
+			}
+			return
+		}
+
+		rel, err := filepath.Rel(dir, r.Path)
+		if err != nil {
+			rel = r.Path
+		}
+		tr := track{path: rel, frames: frameTexts(lines)}
+
+		key := tr.identity()
+		if key == "\x00\x00" {
+			if flagVerbose {
+				slog.Warn("no artist, album and title", "path", r.Path)
+			}
+			return
+		}
+		mu.Lock()
+		tracks[key] = append(tracks[key], tr)
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+
+	for _, t := range tracks {
+		sort.Slice(t, func(i, j int) bool { return t[i].path < t[j].path })
+	}
+	return tracks, stats
+}
+
+// unionKeys returns sorted keys, which are in a or b.
+func unionKeys(a, b map[string][]track) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// frameDiffs returns descriptions of frames, which differ in a and b.
+func frameDiffs(a, b track) []string {
+	ids := make(map[string]bool)
+	for id := range a.frames {
+		ids[id] = true
+	}
+	for id := range b.frames {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, id := range sorted {
+		ta, tb := strings.Join(a.frames[id], "; "), strings.Join(b.frames[id], "; ")
+		if ta != tb {
+			diffs = append(diffs, fmt.Sprintf("%v: %q, %q", id, ta, tb))
+		}
+	}
+	return diffs
+}
+
+// diffFlags returns flags of "tagrep diff" command.
+func diffFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep diff [flags] DIR_A DIR_B
+
+Compares tracks in two directories recursively by their artist, album
+and title, ignoring case and punctuation, regardless of file names.
+Prints tracks, which are only in one of directories, and tracks, whose
+frames differ. Exits with code 1, if there are differences.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output: also print files without artist, album and title")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
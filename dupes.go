@@ -0,0 +1,237 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// dupe is a file checked for duplicates.
+type dupe struct {
+	path   string
+	frames map[string]string
+	audio  audioInfo
+}
+
+// runDupes runs "tagrep dupes" command with args.
+func runDupes(args []string) {
+	flags := dupesFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flagXattrCache && !tagrep.XattrSupported {
+		fmt.Println("ERROR: --xattr-cache is not supported on this platform")
+		os.Exit(1)
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.XattrCache = flagXattrCache
+	query := flagQuery()
+	// Walk also reads frames needed by matchers of query.
+	s.Query = query
+	if flagUseIndex {
+		s.Index = openIndex()
+		defer s.Index.Close()
+	}
+
+	t := time.Now()
+
+	var mu sync.Mutex
+	var files []dupe
+	stats, err := s.Walk(context.Background(), paths, func(r tagrep.Result) {
+		if !query.IsEmpty() && !query.Match(r.Frames) {
+			return
+		}
+		if !flagHash && (r.Frames["Artist"] == "" || r.Frames["Title"] == "") {
+			// Such files can't be compared.
+			return
+		}
+
+		audio, err := readAudioInfo(r.Path, flagHash)
+		if err != nil {
+			if logFileError(r.Path, err) {
+				os.Exit(errorStatus)
+			}
+			return
+		}
+
+		path := r.Path
+		if flagAbs {
+			path = r.AbsPath
+		}
+		mu.Lock()
+		files = append(files, dupe{path: path, frames: r.Frames, audio: audio})
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+
+	var sets [][]dupe
+	if flagHash {
+		sets = groupDupesByHash(files)
+	} else {
+		sets = groupDupesByTags(files, flagTolerance)
+	}
+
+	var n int
+	for _, set := range sets {
+		n += len(set)
+		fmt.Printf("%v (%v)\n", dupeSetTitle(set), formatDuration(set[0].audio.Duration))
+		for _, d := range set {
+			fmt.Printf("  %4v kbps  %v\n", d.audio.Bitrate, d.path)
+		}
+	}
+
+	expired := time.Since(t)
+	fmt.Printf("%v files total, %v duplicates in %v sets in %vms\n",
+		stats.Total, n, len(sets), int(1000*expired.Seconds()))
+	checkScanErrors(stats)
+}
+
+// groupDupesByTags returns sets of files with the same normalized
+// artist and title, whose durations differ at most by tolerance.
+func groupDupesByTags(files []dupe, tolerance time.Duration) [][]dupe {
+	groups := make(map[string][]dupe)
+	for _, d := range files {
+		key := normalizeTag(d.frames["Artist"]) + "\x00" + normalizeTag(d.frames["Title"])
+		groups[key] = append(groups[key], d)
+	}
+
+	var sets [][]dupe
+	for _, group := range groups {
+		// Split group to runs of files with close durations.
+		sort.Slice(group, func(i, j int) bool { return group[i].audio.Duration < group[j].audio.Duration })
+		start := 0
+		for i := 1; i <= len(group); i++ {
+			if i < len(group) && group[i].audio.Duration-group[i-1].audio.Duration <= tolerance {
+				continue
+			}
+			if i-start > 1 {
+				sets = append(sets, group[start:i])
+			}
+			start = i
+		}
+	}
+	sortDupeSets(sets)
+	return sets
+}
+
+// groupDupesByHash returns sets of files with the same audio hash.
+func groupDupesByHash(files []dupe) [][]dupe {
+	groups := make(map[string][]dupe)
+	for _, d := range files {
+		groups[d.audio.Hash] = append(groups[d.audio.Hash], d)
+	}
+
+	var sets [][]dupe
+	for _, group := range groups {
+		if len(group) > 1 {
+			sets = append(sets, group)
+		}
+	}
+	sortDupeSets(sets)
+	return sets
+}
+
+// sortDupeSets sorts files in every set by bitrate, so the best copy
+// is the first, and sets by path of their first file.
+func sortDupeSets(sets [][]dupe) {
+	for _, set := range sets {
+		sort.Slice(set, func(i, j int) bool {
+			if set[i].audio.Bitrate != set[j].audio.Bitrate {
+				return set[i].audio.Bitrate > set[j].audio.Bitrate
+			}
+			return set[i].path < set[j].path
+		})
+	}
+	sort.Slice(sets, func(i, j int) bool { return sets[i][0].path < sets[j][0].path })
+}
+
+// dupeSetTitle returns artist and title of set. Files found
+// by hash may have different or no tags, so the first ones are taken.
+func dupeSetTitle(set []dupe) string {
+	for _, d := range set {
+		if d.frames["Artist"] != "" || d.frames["Title"] != "" {
+			return d.frames["Artist"] + " - " + d.frames["Title"]
+		}
+	}
+	return "no artist and title"
+}
+
+// normalizeTag returns s in lower case with only letters and digits
+// and words separated by one space, so "Help!" and "help" are equal.
+func normalizeTag(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// formatDuration formats d as minutes and seconds (e.g. "3:07").
+func formatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// dupesFlags returns flags of "tagrep dupes" command.
+func dupesFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("dupes", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep dupes [flags] paths
+
+Finds duplicate files and prints sets of them with bitrates, the best
+copy first. Files are duplicates, if they have the same artist and
+title, ignoring case and punctuation, and their durations differ at
+most by --tolerance.
+
+With --hash, files are duplicates, if they have the same audio data,
+even if their tags differ. Whole files are read for hashing.
+
+Frames flags restrict files, which are checked.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	flags.BoolVar(&flagAbs, "abs", false, "print absolute paths")
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.BoolVar(&flagHash, "hash", false, "compare hashes of audio data without tags instead of tags and durations")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.DurationVar(&flagTolerance, "tolerance", 2*time.Second, "maximal difference of durations of duplicates")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	flags.BoolVar(&flagXattrCache, "xattr-cache", false, "cache tags in extended attributes of files (user.tagrep.*)")
+	return flags
+}
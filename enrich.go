@@ -0,0 +1,244 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runEnrich runs "tagrep enrich" command with args.
+func runEnrich(args []string) {
+	if status := enrich(args); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// enrich runs "tagrep enrich" command with args and returns its exit
+// status. Status is returned instead of exiting, so index is closed
+// and MusicBrainz cache is written by deferred calls.
+func enrich(args []string) int {
+	flags := enrichFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		return 1
+	}
+
+	if flagFingerprint && flagAcoustIDKey == "" {
+		fmt.Println("ERROR: --fingerprint needs --acoustid-key")
+		return 1
+	}
+	if flagXattrCache && !tagrep.XattrSupported {
+		fmt.Println("ERROR: --xattr-cache is not supported on this platform")
+		return 1
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.XattrCache = flagXattrCache
+	s.Query = flagQuery()
+	checkQuery(flags, s.Query)
+	if flagUseIndex {
+		s.Index = openIndex()
+		defer s.Index.Close()
+	}
+
+	t := time.Now()
+
+	// Collect found files first, so they're checked in stable order.
+	var mu sync.Mutex
+	var found []tagrep.Result
+	stats, err := s.Scan(context.Background(), paths, func(r tagrep.Result) {
+		mu.Lock()
+		found = append(found, r)
+		mu.Unlock()
+	})
+	if err != nil {
+		slog.Error("can't scan", "err", err)
+		return 1
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+
+	mb := newMBClient(flagMusicBrainzURL, defaultMBCachePath())
+	defer func() {
+		if err := mb.saveCache(); err != nil {
+			slog.Error("can't write MusicBrainz cache", "err", err)
+		}
+	}()
+
+	var acoustID *acoustIDClient
+	if flagFingerprint {
+		acoustID = newAcoustIDClient(flagAcoustIDURL, flagAcoustIDKey)
+	}
+
+	var differ, notFound int
+	// failed is set by --on-error fail, then checking stops.
+	var failed bool
+	for _, r := range found {
+		// Query may have only some of frames, so take all of them.
+		st, err := s.Stat(context.Background(), r.Path)
+		if err != nil {
+			if failed = logFileError(r.Path, err); failed {
+				break
+			}
+			continue
+		}
+
+		var lines []string
+		isDiffer := false
+		artist, title := st.Frames["Artist"], st.Frames["Title"]
+		if artist == "" || title == "" {
+			lines = append(lines, "no artist or title")
+		} else {
+			rec, err := mb.recording(context.Background(), artist, title)
+			switch {
+			case err != nil:
+				failed = logFileError(r.Path, err)
+			case rec == nil:
+				notFound++
+				lines = append(lines, "not found in MusicBrainz")
+			default:
+				diffs := mbDiffs(st.Frames, rec)
+				if len(diffs) > 0 {
+					isDiffer = true
+					lines = append(lines, diffs...)
+					lines = append(lines, fmt.Sprintf("see %v/recording/%v", flagMusicBrainzURL, rec.ID))
+				} else {
+					lines = append(lines, fmt.Sprintf("matches %v/recording/%v", flagMusicBrainzURL, rec.ID))
+				}
+			}
+		}
+
+		if acoustID != nil && !failed {
+			line, ok, err := fingerprintLine(acoustID, r.Path, st.Frames)
+			if err != nil {
+				failed = logFileError(r.Path, err)
+			} else {
+				isDiffer = isDiffer || !ok
+				lines = append(lines, line)
+			}
+		}
+
+		if failed {
+			break
+		}
+		if isDiffer {
+			differ++
+		}
+		if isDiffer || flagVerbose {
+			fmt.Println(r.Path)
+			for _, line := range lines {
+				fmt.Println("  " + line)
+			}
+		}
+	}
+
+	if failed {
+		return errorStatus
+	}
+
+	expired := time.Since(t)
+	fmt.Printf("%v files total, %v found, %v differ, %v not found in MusicBrainz in %vms\n",
+		stats.Total, stats.Found, differ, notFound, int(1000*expired.Seconds()))
+	return scanErrorsStatus(stats)
+}
+
+// fingerprintLine identifies file in path by its audio with acoustID
+// and returns line describing found recording. ok is false,
+// if recording differs from frames of file.
+func fingerprintLine(acoustID *acoustIDClient, path string, frames map[string]string) (line string, ok bool, err error) {
+	fp, err := calcFingerprint(context.Background(), flagFpcalc, path)
+	if err != nil {
+		return "", false, err
+	}
+	rec, err := acoustID.lookup(context.Background(), fp)
+	if err != nil {
+		return "", false, err
+	}
+	if rec == nil {
+		return "fingerprint not found in AcoustID", true, nil
+	}
+
+	ok = rec.Artist() == frames["Artist"] && rec.Title == frames["Title"]
+	line = fmt.Sprintf("fingerprint: %q by %q (score %.0f%%), see %v/recording/%v",
+		rec.Title, rec.Artist(), 100*rec.Score, flagMusicBrainzURL, rec.ID)
+	return line, ok, nil
+}
+
+// mbDiffs returns descriptions of differences between frames
+// and recording rec.
+func mbDiffs(frames map[string]string, rec *mbRecording) []string {
+	var diffs []string
+	diff := func(name, tag, canonical string) {
+		if tag != canonical {
+			diffs = append(diffs, fmt.Sprintf("%v: %q, MusicBrainz has %q", name, tag, canonical))
+		}
+	}
+	diff("Artist", frames["Artist"], rec.Artist())
+	diff("Title", frames["Title"], rec.Title)
+	if frames["Year"] != "" && rec.Year() != "" {
+		// Only year of timestamp is compared.
+		diff("Year", frameYear(frames["Year"]), rec.Year())
+	}
+	return diffs
+}
+
+// enrichFlags returns flags of "tagrep enrich" command.
+func enrichFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("enrich", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep enrich [flags] paths
+
+Looks up found files in MusicBrainz by artist and title and prints
+differences between their tags and MusicBrainz. Requests are limited
+to one per second and cached in tagrep/musicbrainz.json in user's
+cache directory.
+
+With --fingerprint, files are also identified by their audio with
+fpcalc from Chromaprint and AcoustID, so files with wrong or missing
+tags can be found. It needs an API key of application registered at
+https://acoustid.org.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	addListAllFlag(flags)
+	flags.StringVar(&flagAcoustIDKey, "acoustid-key", "", "API key of application for AcoustID")
+	flags.StringVar(&flagAcoustIDURL, "acoustid-url", "https://api.acoustid.org", "URL of AcoustID server")
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.BoolVar(&flagFingerprint, "fingerprint", false, "identify files by audio with AcoustID")
+	flags.StringVar(&flagFpcalc, "fpcalc", "fpcalc", "path of fpcalc from Chromaprint")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.StringVar(&flagMusicBrainzURL, "musicbrainz-url", "https://musicbrainz.org", "URL of MusicBrainz server")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output: also print files matching MusicBrainz and not found there")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	flags.BoolVar(&flagXattrCache, "xattr-cache", false, "cache tags in extended attributes of files (user.tagrep.*)")
+	return flags
+}
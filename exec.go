@@ -0,0 +1,263 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// execBatchSize is the maximum size of paths in one command
+// run by --exec-batch.
+const execBatchSize = 128 << 10
+
+// execCommand is a command run for found files by --exec or --exec-batch.
+type execCommand struct {
+	// words are arguments of command with placeholders.
+	words []string
+	batch bool
+	// fields are used fields of templateFields.
+	fields []string
+	stdin  io.Reader
+
+	mu sync.Mutex
+	// pending are paths waiting for the next command of batch.
+	pending []string
+	size    int
+	// failed is a number of failed commands.
+	failed int
+}
+
+// flagExecCommand returns command given by --exec or --exec-batch
+// or nil, if there is no one. Commands read stdin only if paths
+// are not read from it.
+func flagExecCommand(paths []string) (*execCommand, error) {
+	if flagExec != "" && flagExecBatch != "" {
+		return nil, errors.New("enter only one of --exec and --exec-batch")
+	}
+	var c *execCommand
+	var err error
+	switch {
+	case flagExec != "":
+		c, err = newExecCommand(flagExec, false)
+	case flagExecBatch != "":
+		c, err = newExecCommand(flagExecBatch, true)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !contains(paths, "-") {
+		c.stdin = os.Stdin
+	}
+	return c, nil
+}
+
+// newExecCommand returns command parsed from command like in find:
+// "{}" is replaced by path and trailing ";" (or "+" in batch) is optional.
+// If command has no placeholders, path is appended to it.
+func newExecCommand(command string, batch bool) (*execCommand, error) {
+	words, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	terminator := ";"
+	if batch {
+		terminator = "+"
+	}
+	if len(words) > 0 && words[len(words)-1] == terminator {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return nil, errors.New("command is empty")
+	}
+	if _, err := exec.LookPath(words[0]); err != nil {
+		return nil, err
+	}
+
+	c := &execCommand{words: words, batch: batch}
+	placeholder := false
+	for _, w := range words[1:] {
+		for _, m := range templateField.FindAllStringSubmatch(w, -1) {
+			if !contains(templateFields, m[1]) {
+				return nil, fmt.Errorf("unknown field {%v} in command, fields are {%v}", m[1], strings.Join(templateFields, "}, {"))
+			}
+			if batch {
+				return nil, fmt.Errorf("field {%v} can't be used in batch, only {}", m[1])
+			}
+			if !contains(c.fields, m[1]) {
+				c.fields = append(c.fields, m[1])
+			}
+		}
+		if strings.Contains(w, "{}") {
+			if batch && w != "{}" {
+				return nil, fmt.Errorf("{} must be a separate argument in batch, not %q", w)
+			}
+			placeholder = true
+		}
+	}
+	if !placeholder && len(c.fields) == 0 {
+		c.words = append(c.words, "{}")
+	}
+	return c, nil
+}
+
+// frames returns descriptions of frames of fields used in c.
+func (c *execCommand) frames() []string {
+	frames := make([]string, len(c.fields))
+	for i, name := range c.fields {
+		frames[i] = settableFrames[name]
+	}
+	return frames
+}
+
+// run runs command for file in path found in r. In batch, path is queued.
+// Commands are run one at a time.
+func (c *execCommand) run(r tagrep.Result, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.batch {
+		c.pending = append(c.pending, path)
+		c.size += len(path) + 1
+		if c.size >= execBatchSize {
+			c.flushLocked()
+		}
+		return
+	}
+
+	c.start(c.args(path, r.Frames), "path", path)
+}
+
+// execPlaceholder is "{}" or field of templateFields in words of command.
+var execPlaceholder = regexp.MustCompile(`\{([a-z]*)\}`)
+
+// args returns arguments of command for file in path with frames.
+// Placeholders are replaced in one pass, so placeholders in path and
+// frames are not replaced.
+func (c *execCommand) args(path string, frames map[string]string) []string {
+	args := make([]string, len(c.words))
+	for i, w := range c.words {
+		args[i] = execPlaceholder.ReplaceAllStringFunc(w, func(m string) string {
+			name := m[1 : len(m)-1]
+			if name == "" {
+				return path
+			}
+			if !contains(templateFields, name) {
+				return m
+			}
+			return execField(name, frames)
+		})
+	}
+	return args
+}
+
+// flush runs command for queued paths of batch.
+func (c *execCommand) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+func (c *execCommand) flushLocked() {
+	if len(c.pending) == 0 {
+		return
+	}
+	var args []string
+	for _, w := range c.words {
+		if w == "{}" {
+			args = append(args, c.pending...)
+		} else {
+			args = append(args, w)
+		}
+	}
+	c.start(args, "files", len(c.pending))
+	c.pending, c.size = nil, 0
+}
+
+// start runs command with args and logs its failure with attrs.
+func (c *execCommand) start(args []string, attrs ...interface{}) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = c.stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		c.failed++
+		slog.Error("command failed", append([]interface{}{"cmd", args[0], "err", err}, attrs...)...)
+	}
+}
+
+// execField returns value of field of templateFields from frames.
+// Several values are separated by commas.
+func execField(name string, frames map[string]string) string {
+	text := strings.Join(tagrep.Values(frames[settableFrames[name]]), ", ")
+	switch name {
+	case "disc":
+		return position(text, 1)
+	case "track":
+		return position(text, 2)
+	case "year":
+		return frameYear(text)
+	}
+	return text
+}
+
+// splitCommand splits command to words separated by spaces.
+// Words may be quoted by single or double quotes. In double quotes
+// backslash escapes double quote and backslash.
+func splitCommand(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				word.WriteRune(runes[i])
+			} else if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c in command", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"echo {} ;", []string{"echo", "{}", ";"}},
+		{"  echo   a\tb ", []string{"echo", "a", "b"}},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}},
+		{`echo "a \"b\" \\ \x"`, []string{"echo", `a "b" \ \x`}},
+		{`echo '' x`, []string{"echo", "", "x"}},
+		{`C:\bin\x.exe {}`, []string{`C:\bin\x.exe`, "{}"}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.command)
+		if err != nil {
+			t.Errorf("splitCommand(%q): %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	for _, command := range []string{`echo 'a`, `echo "a`} {
+		if _, err := splitCommand(command); err == nil {
+			t.Errorf("splitCommand(%q) returned no error", command)
+		}
+	}
+}
+
+func TestExecCommandArgs(t *testing.T) {
+	frames := map[string]string{
+		"Artist":                             "Queen\x00David Bowie",
+		"Title/Songname/Content description": "Under {artist}",
+		"Track number/Position in set":       "3/12",
+		"Year":                               "1981-10-26",
+	}
+	tests := []struct {
+		command string
+		path    string
+		want    []string
+	}{
+		{"echo {} ;", "a.mp3", []string{"echo", "a.mp3"}},
+		{"echo", "a.mp3", []string{"echo", "a.mp3"}},
+		{"echo {}.txt", "a.mp3", []string{"echo", "a.mp3.txt"}},
+		{"echo {artist}", "a.mp3", []string{"echo", "Queen, David Bowie"}},
+		{"echo {track}-{year}", "a.mp3", []string{"echo", "03-1981"}},
+		// Placeholders in path and frames are not replaced.
+		{"echo {}", "/music/{title}.mp3", []string{"echo", "/music/{title}.mp3"}},
+		{"echo {} {title}", "{}.mp3", []string{"echo", "{}.mp3", "Under {artist}"}},
+		{"echo {album}", "a.mp3", []string{"echo", ""}},
+	}
+	for _, tt := range tests {
+		c, err := newExecCommand(tt.command, false)
+		if err != nil {
+			t.Errorf("newExecCommand(%q): %v", tt.command, err)
+			continue
+		}
+		if got := c.args(tt.path, frames); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("args of %q for %q = %q, want %q", tt.command, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewExecCommandErrors(t *testing.T) {
+	tests := []struct {
+		command string
+		batch   bool
+	}{
+		{"", false},
+		{";", false},
+		{"echo {nosuchfield}", false},
+		{"echo {artist}", true},
+		{"echo x{}", true},
+		{"nosuchcommand-tagrep {}", false},
+	}
+	for _, tt := range tests {
+		if _, err := newExecCommand(tt.command, tt.batch); err == nil {
+			t.Errorf("newExecCommand(%q, %v) returned no error", tt.command, tt.batch)
+		}
+	}
+}
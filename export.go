@@ -0,0 +1,348 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+	_ "modernc.org/sqlite"
+)
+
+// exportedFile is a file with all its frames.
+type exportedFile struct {
+	path  string
+	size  int64
+	mtime time.Time
+	// frames are texts of frames keyed by IDs.
+	frames map[string][]string
+}
+
+// runExport runs "tagrep export" command with args.
+func runExport(args []string) {
+	flags := exportFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flagSQLite == "" && flagCSV == "" {
+		fmt.Println("ERROR: enter --sqlite or --csv")
+		os.Exit(1)
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	query := flagQuery()
+	// Walk also reads frames needed by matchers of query.
+	s.Query = query
+
+	t := time.Now()
+
+	var mu sync.Mutex
+	var files []exportedFile
+	stats, err := s.Walk(context.Background(), paths, func(r tagrep.Result) {
+		if !query.IsEmpty() && !query.Match(r.Frames) {
+			return
+		}
+		lines, err := readFrameLines(r.Path)
+		if err != nil {
+			if logFileError(r.Path, err) {
+				os.Exit(errorStatus)
+			}
+			return
+		}
+
+		path := r.Path
+		if flagAbs {
+			path = r.AbsPath
+		}
+		f := exportedFile{path: path, size: r.Info.Size(), mtime: r.Info.ModTime(), frames: frameTexts(lines)}
+		mu.Lock()
+		files = append(files, f)
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	if flagSQLite != "" {
+		if err := exportSQLite(flagSQLite, files); err != nil {
+			fmt.Println("ERROR: can't export to SQLite:", err)
+			os.Exit(1)
+		}
+	}
+	// Keep stdout parsable, if CSV is written there.
+	summary := os.Stdout
+	if flagCSV != "" {
+		if flagCSV == "-" {
+			summary = os.Stderr
+		}
+		if err := exportCSV(flagCSV, files); err != nil {
+			fmt.Println("ERROR: can't export to CSV:", err)
+			os.Exit(1)
+		}
+	}
+
+	expired := time.Since(t)
+	fmt.Fprintf(summary, "%v files total, %v exported in %vms\n", stats.Total, len(files), int(1000*expired.Seconds()))
+	checkScanErrors(stats)
+}
+
+// csvFields are names of columns of CSV after "path".
+// They're names of flags of "tagrep set".
+var csvFields = []string{"artist", "albumartist", "album", "disc", "track", "title", "year", "genre"}
+
+// csvValueSeparator separates values of frames in cells of CSV.
+// NULs, which separate them in frames, are dropped by spreadsheets.
+// Semicolons and backslashes in values are escaped by backslash,
+// so values containing separator are imported unchanged.
+const csvValueSeparator = "; "
+
+// csvEscaper escapes values of frames in cells of CSV.
+var csvEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`)
+
+// joinCSVValues returns cell of CSV with escaped values.
+func joinCSVValues(values []string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = csvEscaper.Replace(v)
+	}
+	return strings.Join(escaped, csvValueSeparator)
+}
+
+// exportCSV writes path and csvFields of files to CSV file in path.
+// If path is "-", CSV is written to stdout.
+func exportCSV(path string, files []exportedFile) error {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	w.Write(append([]string{"path"}, csvFields...))
+	record := make([]string, 1+len(csvFields))
+	for _, f := range files {
+		record[0] = f.path
+		for i, name := range csvFields {
+			// Only year has different IDs in ID3v2.3 and ID3v2.4.
+			desc := settableFrames[name]
+			texts := f.frames[id3v2.V24CommonIDs[desc]]
+			if len(texts) == 0 {
+				texts = f.frames[id3v2.V23CommonIDs[desc]]
+			}
+			var values []string
+			for _, text := range texts {
+				values = append(values, tagrep.Values(text)...)
+			}
+			record[1+i] = joinCSVValues(values)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		return out.Close()
+	}
+	return nil
+}
+
+// frameIDs returns sorted IDs of frames of files.
+func frameIDs(files []exportedFile) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, f := range files {
+		for id := range f.frames {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// exportSQLite writes files to SQLite database in path. Tables are
+// replaced, so database can be exported to repeatedly:
+//
+//   - files has one row per file with path, size, mtime and column
+//     per frame ID. Texts of multiple frames with the same ID are
+//     joined by "; ". Column names of SQLite are case-insensitive, so
+//     nonstandard IDs like "SIZE", which collide with other columns,
+//     get no columns.
+//   - frames has one row per frame with path, id and text.
+func exportSQLite(path string, files []exportedFile) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := columnIDs(frameIDs(files))
+	columns := []string{"path TEXT PRIMARY KEY", "size INTEGER", "mtime TEXT"}
+	for _, id := range ids {
+		columns = append(columns, sqlQuote(id)+" TEXT")
+	}
+	stmts := []string{
+		"DROP TABLE IF EXISTS files",
+		"DROP TABLE IF EXISTS frames",
+		"CREATE TABLE files (" + strings.Join(columns, ", ") + ")",
+		"CREATE TABLE frames (path TEXT NOT NULL, id TEXT NOT NULL, text TEXT)",
+		"CREATE INDEX frames_id ON frames (id, text)",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	names := []string{"path", "size", "mtime"}
+	for _, id := range ids {
+		names = append(names, sqlQuote(id))
+	}
+	insertFile, err := tx.Prepare("INSERT INTO files (" + strings.Join(names, ", ") + ") VALUES (?" + strings.Repeat(", ?", len(names)-1) + ")")
+	if err != nil {
+		return err
+	}
+	defer insertFile.Close()
+	insertFrame, err := tx.Prepare("INSERT INTO frames (path, id, text) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insertFrame.Close()
+
+	values := make([]interface{}, len(names))
+	for _, f := range files {
+		values[0], values[1], values[2] = f.path, f.size, f.mtime.UTC().Format(time.RFC3339)
+		for i, id := range ids {
+			if texts, ok := f.frames[id]; ok {
+				values[3+i] = strings.Join(texts, "; ")
+			} else {
+				values[3+i] = nil
+			}
+		}
+		if _, err := insertFile.Exec(values...); err != nil {
+			return err
+		}
+
+		for _, id := range sortedKeys(f.frames) {
+			for _, text := range f.frames[id] {
+				if _, err := insertFrame.Exec(f.path, id, text); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// columnIDs returns frame IDs from ids, which have columns in files
+// table of SQLite: IDs equal to other columns ignoring case are dropped.
+func columnIDs(ids []string) []string {
+	taken := map[string]bool{"path": true, "size": true, "mtime": true}
+	var columns []string
+	for _, id := range ids {
+		if name := strings.ToLower(id); !taken[name] {
+			taken[name] = true
+			columns = append(columns, id)
+		}
+	}
+	return columns
+}
+
+// sortedKeys returns sorted keys of m.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sqlQuote quotes identifier for SQL.
+func sqlQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// exportFlags returns flags of "tagrep export" command.
+func exportFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("export", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep export --sqlite FILE [flags] paths
+  tagrep export --csv FILE [flags] paths
+
+Exports all frames of files to SQLite database. Table "files" has one
+row per file with columns path, size, mtime and column per frame ID
+(e.g. TPE1). Texts of frames with the same ID are joined by "; ".
+Nonstandard IDs equal to other columns ignoring case (e.g. SIZE)
+have no columns.
+Table "frames" has one row per frame with columns path, id and text.
+Tables are replaced, if they exist. For example:
+
+  tagrep export --sqlite library.db -r /music
+  sqlite3 library.db 'SELECT TPE1, count(*) FROM files GROUP BY TPE1'
+
+CSV has columns path, %v.
+Several values of frame are separated by "; " in it, semicolons
+and backslashes in values are escaped by backslash.
+It can be edited and written back by "tagrep import". Use "-" as FILE
+to write CSV to stdout.
+
+Frames flags restrict files, which are exported. If no frames are
+given, all files are exported.
+
+Flags:
+`, strings.Join(csvFields, ", "))
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	flags.BoolVar(&flagAbs, "abs", false, "export absolute paths")
+	flags.StringVar(&flagCSV, "csv", "", "path of CSV file to export frames editable by \"tagrep import\" to")
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.StringVar(&flagSQLite, "sqlite", "", "path of SQLite database to export to")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportSQLiteCollidingIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "library.db")
+	files := []exportedFile{{
+		path:   "a.mp3",
+		size:   128,
+		mtime:  time.Unix(0, 0),
+		frames: map[string][]string{"TPE1": {"Queen"}, "SIZE": {"big"}, "PATH": {"x"}},
+	}}
+	if err := exportSQLite(path, files); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var size int64
+	var artist string
+	if err := db.QueryRow("SELECT size, TPE1 FROM files WHERE path = 'a.mp3'").Scan(&size, &artist); err != nil {
+		t.Fatal(err)
+	}
+	if size != 128 || artist != "Queen" {
+		t.Errorf("size is %v and TPE1 is %q, want 128 and Queen", size, artist)
+	}
+	var text string
+	if err := db.QueryRow("SELECT text FROM frames WHERE id = 'SIZE'").Scan(&text); err != nil {
+		t.Fatal(err)
+	}
+	if text != "big" {
+		t.Errorf("text of SIZE is %q, want big", text)
+	}
+}
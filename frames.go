@@ -0,0 +1,91 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// frameLine is a frame of tag in readable form.
+type frameLine struct {
+	ID   string
+	Text string
+}
+
+// readFrameLines parses all frames of file in path and returns them
+// sorted by IDs. If file has no tag, it returns nil.
+func readFrameLines(path string) ([]frameLine, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	all := tag.AllFrames()
+	ids := make([]string, 0, len(all))
+	for id := range all {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var lines []frameLine
+	for _, id := range ids {
+		for _, f := range all[id] {
+			text := frameText(f)
+			if _, ok := f.(id3v2.TextFrame); ok {
+				// Names of genres are compared and exported instead of codes.
+				text = normalizedText(id, text)
+			}
+			lines = append(lines, frameLine{ID: id, Text: text})
+		}
+	}
+	return lines, nil
+}
+
+// normalizedText returns text of text frame with id as it's read
+// by readFrameLines: cleaned and with names of genres instead of codes.
+func normalizedText(id, text string) string {
+	text = tagrep.CleanText(text)
+	if id == "TCON" {
+		text = tagrep.NormalizeGenre(text)
+	}
+	return text
+}
+
+// frameTexts returns texts of lines keyed by IDs of frames.
+func frameTexts(lines []frameLine) map[string][]string {
+	texts := make(map[string][]string)
+	for _, l := range lines {
+		texts[l.ID] = append(texts[l.ID], l.Text)
+	}
+	return texts
+}
+
+// frameText returns readable text of frame f.
+// Binary frames are summarized.
+func frameText(f id3v2.Framer) string {
+	switch f := f.(type) {
+	case id3v2.TextFrame:
+		return tagrep.CleanText(f.Text)
+	case id3v2.CommentFrame:
+		return fmt.Sprintf("[%v] %v: %v", f.Language, f.Description, f.Text)
+	case id3v2.UnsynchronisedLyricsFrame:
+		return fmt.Sprintf("[%v] %v: %v", f.Language, f.ContentDescriptor, f.Lyrics)
+	case id3v2.UserDefinedTextFrame:
+		return f.Description + ": " + f.Value
+	case id3v2.PictureFrame:
+		return fmt.Sprintf("%v, %v, %v bytes", f.MimeType, f.Description, len(f.Picture))
+	case id3v2.PopularimeterFrame:
+		return fmt.Sprintf("%v: rating %v, counter %v", f.Email, f.Rating, f.Counter)
+	case id3v2.UFIDFrame:
+		return fmt.Sprintf("%v: %x", f.OwnerIdentifier, f.Identifier)
+	default:
+		return fmt.Sprintf("%v bytes", f.Size())
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/n10v/tagrep/tagreppb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// serveGRPC serves gRPC API for searching in paths with scanner on addr.
+func serveGRPC(addr string, scanner *tagrep.Scanner, paths []string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	tagreppb.RegisterTagrepServer(srv, &grpcServer{scanner: scanner, paths: paths})
+	return srv.Serve(lis)
+}
+
+// grpcServer implements tagreppb.TagrepServer.
+type grpcServer struct {
+	tagreppb.UnimplementedTagrepServer
+
+	scanner *tagrep.Scanner
+	paths   []string
+}
+
+func (srv *grpcServer) Search(req *tagreppb.SearchRequest, stream grpc.ServerStreamingServer[tagreppb.File]) error {
+	q := req.GetQuery()
+	// Copy scanner, because requests are served concurrently.
+	s := *srv.scanner
+	s.Query = tagrep.Query{
+		Artist:     q.GetArtist(),
+		Title:      q.GetTitle(),
+		Year:       q.GetYear(),
+		IgnoreCase: q.GetIgnoreCase(),
+	}
+	if s.Query.IsEmpty() {
+		return status.Error(codes.InvalidArgument, "enter at least one of artist, title and year")
+	}
+	if req.GetMaxCount() < 0 {
+		return status.Error(codes.InvalidArgument, "invalid max_count")
+	}
+	s.MaxCount = req.GetMaxCount()
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	results, errs := s.Stream(ctx, srv.paths)
+	for results != nil || errs != nil {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			if err := stream.Send(protoFile(r)); err != nil {
+				return err
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			var fileErr *tagrep.FileError
+			if errors.As(err, &fileErr) {
+				if srv.scanner.OnError != nil {
+					srv.scanner.OnError(fileErr.Path, fileErr.Err)
+				}
+				continue
+			}
+			return grpcError(err)
+		}
+	}
+	return nil
+}
+
+func (srv *grpcServer) Index(req *tagreppb.IndexRequest, stream grpc.ServerStreamingServer[tagreppb.IndexChange]) error {
+	if srv.scanner.Index == nil {
+		return status.Error(codes.FailedPrecondition, "server is started without --use-index")
+	}
+
+	s := *srv.scanner
+	var mu sync.Mutex
+	var sendErr error
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	_, err := s.UpdateIndex(ctx, srv.paths, func(path string, ch tagrep.Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr != nil {
+			return
+		}
+		sendErr = stream.Send(&tagreppb.IndexChange{Kind: tagreppb.IndexChange_Kind(ch), Path: path})
+		if sendErr != nil {
+			cancel()
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	return grpcError(err)
+}
+
+func (srv *grpcServer) Stat(ctx context.Context, req *tagreppb.StatRequest) (*tagreppb.File, error) {
+	path, err := filepath.Abs(req.GetPath())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !isInPaths(path, srv.paths) {
+		return nil, status.Error(codes.PermissionDenied, "path is not in served paths")
+	}
+
+	s := *srv.scanner
+	r, err := s.Stat(ctx, path)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return protoFile(r), nil
+}
+
+// protoFile converts r to tagreppb.File.
+func protoFile(r tagrep.Result) *tagreppb.File {
+	return &tagreppb.File{
+		Path:    r.AbsPath,
+		Size:    r.Info.Size(),
+		ModTime: timestamppb.New(r.Info.ModTime()),
+		Frames:  r.Frames,
+	}
+}
+
+// grpcError converts err to gRPC status error. It returns nil, if err is nil.
+func grpcError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// isInPaths reports whether absolute path is one of paths
+// or is in one of them.
+func isInPaths(path string, paths []string) bool {
+	path = tagrep.NormalizePath(path)
+	for _, p := range paths {
+		p, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		p = tagrep.NormalizePath(p)
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+var (
+	positionValue = regexp.MustCompile(`^[0-9]+(/[0-9]+)?$`)
+	dateValue     = regexp.MustCompile(`^[0-9]{4}(-[0-9]{2}(-[0-9]{2})?)?$`)
+	yearValue     = regexp.MustCompile(`^[0-9]{4}$`)
+)
+
+// runImport runs "tagrep import" command with args.
+func runImport(args []string) {
+	flags := importFlags()
+	parseFlags(flags, args)
+
+	if flagCSV == "" {
+		fmt.Println("ERROR: enter --csv")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	in := os.Stdin
+	if flagCSV != "-" {
+		f, err := os.Open(flagCSV)
+		if err != nil {
+			fmt.Println("ERROR: can't open CSV:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		fmt.Println("ERROR: can't read header of CSV:", err)
+		os.Exit(1)
+	}
+	if err := checkCSVHeader(header); err != nil {
+		fmt.Println("ERROR: invalid header of CSV:", err)
+		os.Exit(1)
+	}
+
+	summary := newChangeSummary()
+
+	var rows int64
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		rows++
+		if err != nil {
+			// Errors of reader have lines.
+			slog.Error("can't read CSV", "err", err)
+			summary.failed++
+			continue
+		}
+		line, _ := r.FieldPos(0)
+
+		path, values, err := csvRow(header, record)
+		if err != nil {
+			slog.Error("invalid row", "line", line, "err", err)
+			summary.failed++
+			continue
+		}
+
+		diffs, err := setFrames(path, values, true, flagDryRun)
+		if err != nil {
+			summary.fail(fmt.Sprintf("line %v: %v", line, path), err)
+			continue
+		}
+		summary.change(path, diffs)
+	}
+
+	// Every row is a file.
+	summary.print(rows)
+	if summary.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkCSVHeader checks that header has path and only known fields.
+func checkCSVHeader(header []string) error {
+	seen := make(map[string]bool)
+	for _, name := range header {
+		if _, ok := settableFrames[name]; !ok && name != "path" {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+	}
+	if !seen["path"] {
+		return errors.New("no path column")
+	}
+	return nil
+}
+
+// csvRow returns path and values of frames keyed by names of flags
+// of "tagrep set" from record with header. Values are validated.
+// Values in cells separated by csvValueSeparator are separated
+// by tagrep.ValueSeparator in returned ones.
+func csvRow(header, record []string) (string, map[string]string, error) {
+	var path string
+	values := make(map[string]string)
+	for i, name := range header {
+		v := record[i]
+		switch name {
+		case "path":
+			path = v
+			continue
+		case "disc", "track":
+			if v != "" && !positionValue.MatchString(v) {
+				return "", nil, fmt.Errorf("invalid %v %q, must be number or number/total", name, v)
+			}
+		case "year":
+			if v != "" && !dateValue.MatchString(v) {
+				return "", nil, fmt.Errorf("invalid year %q, must be YYYY, YYYY-MM or YYYY-MM-DD (only YYYY in ID3v2.3 tags)", v)
+			}
+		}
+		values[name] = strings.Join(splitCSVValues(v), tagrep.ValueSeparator)
+	}
+
+	if path == "" {
+		return "", nil, errors.New("empty path")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("%v is not a regular file", path)
+	}
+	return path, values, nil
+}
+
+// splitCSVValues returns unescaped values of cell of CSV
+// written by joinCSVValues.
+func splitCSVValues(cell string) []string {
+	var values []string
+	var b strings.Builder
+	for i := 0; i < len(cell); i++ {
+		switch {
+		case cell[i] == '\\' && i+1 < len(cell):
+			i++
+			b.WriteByte(cell[i])
+		case strings.HasPrefix(cell[i:], csvValueSeparator):
+			values = append(values, b.String())
+			b.Reset()
+			i += len(csvValueSeparator) - 1
+		default:
+			b.WriteByte(cell[i])
+		}
+	}
+	return append(values, b.String())
+}
+
+// importFlags returns flags of "tagrep import" command.
+func importFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("import", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep import --csv FILE [flags]
+
+Sets frames of files from CSV exported by "tagrep export --csv".
+Columns are path and some of %v.
+Empty value deletes frame. Invalid rows are skipped and reported,
+then tagrep exits with code 1. Use "-" as FILE to read CSV from stdin.
+
+Flags:
+`, strings.Join(csvFields, ", "))
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&flagCSV, "csv", "", "path of CSV file to import")
+	addDryRunFlag(flags)
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	return flags
+}
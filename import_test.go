@@ -0,0 +1,254 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogem/id3v2"
+)
+
+// writeTestTag writes file with ID3v2.4 tag with text frames
+// keyed by IDs to path.
+func writeTestTag(t *testing.T, path string, frames map[string]string) {
+	t.Helper()
+	if err := os.WriteFile(path, append([]byte{0xff, 0xfb}, make([]byte, 126)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	tag.SetVersion(4)
+	for id, text := range frames {
+		tag.AddTextFrame(id, id3v2.EncodingUTF8, text)
+	}
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	writeTestTag(t, path, map[string]string{
+		"TPE1": "Queen  ",
+		"TIT2": "Bohemian Rhapsody\x00",
+		"TCON": "(17)",
+		"TDRC": "1975",
+	})
+
+	lines, err := readFrameLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(dir, "tags.csv")
+	if err := exportCSV(csvPath, []exportedFile{{path: path, frames: frameTexts(lines)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %v records, want header and one row", len(records))
+	}
+
+	gotPath, values, err := csvRow(records[0], records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != path {
+		t.Errorf("path is %q, want %q", gotPath, path)
+	}
+	if values["genre"] != "Rock" || values["artist"] != "Queen" {
+		t.Errorf("exported genre %q and artist %q, want normalized", values["genre"], values["artist"])
+	}
+	diffs, err := setFrames(path, values, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unedited export changes file: %q", diffs)
+	}
+}
+
+func TestExportCSVMultipleValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	writeTestTag(t, path, map[string]string{
+		"TPE1": "Queen\x00David Bowie",
+		"TCON": "(4)Eurodisco",
+	})
+
+	lines, err := readFrameLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(dir, "tags.csv")
+	if err := exportCSV(csvPath, []exportedFile{{path: path, frames: frameTexts(lines)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		t.Errorf("CSV contains NUL: %q", data)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %v records, want header and one row", len(records))
+	}
+	if got := records[1][1]; got != "Queen; David Bowie" {
+		t.Errorf("exported artist %q, want %q", got, "Queen; David Bowie")
+	}
+
+	_, values, err := csvRow(records[0], records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["artist"] != "Queen\x00David Bowie" || values["genre"] != "Disco\x00Eurodisco" {
+		t.Errorf("imported artist %q and genre %q, want values separated by NUL", values["artist"], values["genre"])
+	}
+	diffs, err := setFrames(path, values, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unedited export changes file: %q", diffs)
+	}
+}
+
+func TestSetFramesComparesRawText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	writeTestTag(t, path, map[string]string{"TPE1": "Queen\x00"})
+
+	values := map[string]string{"artist": "Queen"}
+	diffs, err := setFrames(path, values, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("set doesn't replace artist with trailing NUL: %q", diffs)
+	}
+	diffs, err = setFrames(path, values, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("import of exported artist changes file: %q", diffs)
+	}
+}
+
+func TestExportCSVEscapedSeparator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mp3")
+	writeTestTag(t, path, map[string]string{
+		"TIT2": "Part 1; Part 2",
+		"TPE1": `AC\DC;`,
+	})
+
+	lines, err := readFrameLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(dir, "tags.csv")
+	if err := exportCSV(csvPath, []exportedFile{{path: path, frames: frameTexts(lines)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, values, err := csvRow(records[0], records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["title"] != "Part 1; Part 2" || values["artist"] != `AC\DC;` {
+		t.Errorf("imported title %q and artist %q, want them unchanged", values["title"], values["artist"])
+	}
+	diffs, err := setFrames(path, values, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unedited export changes file: %q", diffs)
+	}
+}
+
+// writeTestTagV23 is like writeTestTag, but writes ID3v2.3 tag.
+func writeTestTagV23(t *testing.T, path string, frames map[string]string) {
+	t.Helper()
+	writeTestTag(t, path, frames)
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	tag.SetVersion(3)
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetFramesNonLatinV23(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	writeTestTagV23(t, path, map[string]string{"TIT2": "Gruppa krovi"})
+
+	if _, err := setFrames(path, map[string]string{"title": "Группа крови", "artist": "Кино"}, false, false); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Version() != 3 {
+		t.Errorf("version is %v, want 3", tag.Version())
+	}
+	if tag.Title() != "Группа крови" || tag.Artist() != "Кино" {
+		t.Errorf("title is %q and artist is %q after setting", tag.Title(), tag.Artist())
+	}
+}
+
+func TestSetFramesYearV23(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	writeTestTagV23(t, path, map[string]string{"TYER": "1975"})
+
+	for _, year := range []string{"1975-10", "1975-10-31"} {
+		if _, err := setFrames(path, map[string]string{"year": year}, false, false); err == nil {
+			t.Errorf("year %q is set in ID3v2.3 tag", year)
+		}
+	}
+	diffs, err := setFrames(path, map[string]string{"year": "1976"}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("year 1976 isn't set in ID3v2.3 tag: %q", diffs)
+	}
+}
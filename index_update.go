@@ -0,0 +1,119 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runIndex runs "tagrep index" command with args.
+func runIndex(args []string) {
+	flags := indexFlags()
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 || flags.Arg(0) != "update" {
+		fmt.Println("ERROR: unknown index command")
+		flags.Usage()
+		os.Exit(1)
+	}
+	paths := flags.Args()[1:]
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+	if status := updateIndex(paths); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// updateIndex updates index by files in paths and returns exit status.
+// Status is returned instead of exiting, so index is closed and profiles
+// are written by deferred calls.
+func updateIndex(paths []string) int {
+	s := newScanner()
+	s.Index = openIndex()
+	defer s.Index.Close()
+
+	stopProfile := initProfile()
+	defer stopProfile()
+	out := newPrinter(os.Stdout, '\n')
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	t := time.Now()
+
+	var mu sync.Mutex
+	counts := make(map[tagrep.Change]int)
+	stats, err := s.UpdateIndex(ctx, paths, func(path string, ch tagrep.Change) {
+		mu.Lock()
+		counts[ch]++
+		mu.Unlock()
+		out.Print(ch.String() + " " + path)
+	})
+	// Files updated before interruption stay in index.
+	interrupted := errors.Is(err, context.Canceled)
+	if err != nil && !interrupted {
+		slog.Error("can't update index", "err", err)
+		return errorStatus
+	}
+	if err := out.Close(); err != nil {
+		slog.Error("can't write output", "err", err)
+		return errorStatus
+	}
+	expired := time.Since(t)
+
+	fmt.Printf("%v files total, %v added, %v modified, %v deleted in %vms\n",
+		stats.Total, counts[tagrep.Added], counts[tagrep.Modified], counts[tagrep.Deleted], int(1000*expired.Seconds()))
+	if interrupted {
+		fmt.Println("Deleted files were not removed from index")
+		printInterrupted(os.Stdout, stats)
+		return interruptedStatus
+	}
+	return scanErrorsStatus(stats)
+}
+
+// indexFlags returns flags of "tagrep index" command.
+func indexFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("index", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep index update [flags] paths
+
+Walks paths recursively and updates index: adds new files,
+reparses modified ones and removes deleted ones.
+Changes are printed as "A path", "M path" and "D path".
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `index files only with given extensions. use "*" for indexing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagIndex, "index", "", "path of index (default is tagrep/index.db in user's cache directory)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVar(&flagNice, "nice", false, "low-impact mode: throttle reading, use one job and lowest CPU and I/O priority")
+	flags.BoolVarP(&flagNull, "null", "0", false, `paths read from stdin are separated by NUL instead of newline (use with "find -print0")`)
+	flags.StringSliceVar(&flagProfile, "profile", nil, "write given profiles (cpu, mem, trace) to tagrep.* files in current directory")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,436 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// Codes of problems reported by "tagrep lint".
+const (
+	lintMissingFrame    = "missing-frame"
+	lintAlbumArtist     = "album-artist"
+	lintTrackGap        = "track-gap"
+	lintInvalidTrack    = "invalid-track"
+	lintInvalidText     = "invalid-text"
+	lintMojibake        = "mojibake"
+	lintInvalidYear     = "invalid-year"
+	lintImplausibleYear = "implausible-year"
+)
+
+// lintCodes are codes of problems in order of appearance in usage.
+var lintCodes = []string{
+	lintMissingFrame, lintAlbumArtist, lintTrackGap, lintInvalidTrack,
+	lintInvalidText, lintMojibake, lintInvalidYear, lintImplausibleYear,
+}
+
+// minYear is the earliest plausible year of recording.
+const minYear = 1860
+
+// maxTrack is the maximum valid track number and total.
+const maxTrack = 999
+
+// problem is a problem of tags found by "tagrep lint".
+type problem struct {
+	// Path is a path of file or, for problems of album, of directory.
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// lintFile is a file checked by "tagrep lint".
+type lintFile struct {
+	path string
+	// frames are texts of frames keyed by IDs.
+	frames map[string][]string
+	// problems are problems of single file.
+	problems []problem
+}
+
+func (f lintFile) frame(id string) string {
+	if texts := f.frames[id]; len(texts) > 0 {
+		return texts[0]
+	}
+	return ""
+}
+
+// runLint runs "tagrep lint" command with args.
+func runLint(args []string) {
+	flags := lintFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flagFormat != "text" && flagFormat != "json" {
+		fmt.Println("ERROR: unknown format", flagFormat)
+		os.Exit(1)
+	}
+	for _, code := range flagDisable {
+		if !contains(lintCodes, code) {
+			fmt.Printf("ERROR: unknown code %q, codes are %v\n", code, strings.Join(lintCodes, ", "))
+			os.Exit(1)
+		}
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	query := flagQuery()
+	// Walk also reads frames needed by matchers of query.
+	s.Query = query
+
+	t := time.Now()
+
+	var mu sync.Mutex
+	var files []lintFile
+	stats, err := s.Walk(context.Background(), paths, func(r tagrep.Result) {
+		if !query.IsEmpty() && !query.Match(r.Frames) {
+			return
+		}
+		f, err := readLintFile(r.Path)
+		if err != nil {
+			if logFileError(r.Path, err) {
+				os.Exit(errorStatus)
+			}
+			return
+		}
+		mu.Lock()
+		files = append(files, f)
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	var problems []problem
+	for _, f := range files {
+		problems = append(problems, f.problems...)
+	}
+	problems = append(problems, lintAlbums(files)...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+
+	var reported int
+	for _, p := range problems {
+		if contains(flagDisable, p.Code) {
+			continue
+		}
+		reported++
+		if flagFormat == "json" {
+			b, _ := json.Marshal(p)
+			fmt.Println(string(b))
+		} else {
+			fmt.Printf("%v: %v: %v\n", p.Path, p.Code, p.Message)
+		}
+	}
+
+	// Keep stdout parsable in JSON format.
+	summary := os.Stdout
+	if flagFormat == "json" {
+		summary = os.Stderr
+	}
+	expired := time.Since(t)
+	fmt.Fprintf(summary, "%v files total, %v checked, %v problems in %vms\n", stats.Total, len(files), reported, int(1000*expired.Seconds()))
+	checkScanErrors(stats)
+
+	if reported > 0 {
+		os.Exit(1)
+	}
+}
+
+// readLintFile reads frames of file in path and checks problems,
+// which don't depend on other files.
+func readLintFile(path string) (lintFile, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return lintFile{}, err
+	}
+	defer tag.Close()
+
+	f := lintFile{path: path, frames: make(map[string][]string)}
+	report := func(code, format string, a ...interface{}) {
+		f.problems = append(f.problems, problem{Path: path, Code: code, Message: fmt.Sprintf(format, a...)})
+	}
+
+	all := tag.AllFrames()
+	for _, id := range sortedFrameIDs(all) {
+		for _, fr := range all[id] {
+			f.frames[id] = append(f.frames[id], frameText(fr))
+			tf, ok := fr.(id3v2.TextFrame)
+			if !ok {
+				continue
+			}
+			if !utf8.ValidString(tf.Text) || strings.ContainsRune(tf.Text, utf8.RuneError) {
+				report(lintInvalidText, "%v has invalid characters: %q", id, tf.Text)
+			} else if tf.Encoding.Equals(id3v2.EncodingISO) && isMojibake(tf.Text) {
+				report(lintMojibake, "%v is UTF-8 stored as ISO-8859-1: %q", id, tf.Text)
+			}
+		}
+	}
+
+	for _, id := range flagRequire {
+		if strings.TrimSpace(f.frame(id)) == "" {
+			report(lintMissingFrame, "no %v", id)
+		}
+	}
+
+	if track := f.frame("TRCK"); track != "" && !validTrack(track) {
+		report(lintInvalidTrack, "TRCK %q is not number or number/total up to %v", track, maxTrack)
+	}
+
+	id, year := "TDRC", f.frame("TDRC")
+	if year == "" {
+		id, year = "TYER", f.frame("TYER")
+	}
+	if year != "" {
+		if len(year) > 4 {
+			year = year[:4]
+		}
+		if y, err := strconv.Atoi(year); err != nil || len(year) < 4 {
+			report(lintInvalidYear, "%v %q is not a year", id, f.frame(id))
+		} else if max := time.Now().Year() + 1; y < minYear || y > max {
+			report(lintImplausibleYear, "%v %v is not between %v and %v", id, y, minYear, max)
+		}
+	}
+
+	return f, nil
+}
+
+// sortedFrameIDs returns sorted keys of frames.
+func sortedFrameIDs(frames map[string][]id3v2.Framer) []string {
+	ids := make([]string, 0, len(frames))
+	for id := range frames {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// isMojibake reports whether s decoded from ISO-8859-1 is actually
+// UTF-8 with non-ASCII characters, e.g. "BjÃ¶rk".
+func isMojibake(s string) bool {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return false
+		}
+		b = append(b, byte(r))
+	}
+	return len(b) != utf8.RuneCount(b) && utf8.Valid(b)
+}
+
+// lintAlbums checks problems of albums in files. Album is files
+// with the same album in the same directory.
+func lintAlbums(files []lintFile) []problem {
+	type album struct {
+		dir, name string
+	}
+	albums := make(map[album][]lintFile)
+	var keys []album
+	for _, f := range files {
+		name := f.frame("TALB")
+		if name == "" {
+			continue
+		}
+		a := album{filepath.Dir(f.path), name}
+		if _, ok := albums[a]; !ok {
+			keys = append(keys, a)
+		}
+		albums[a] = append(albums[a], f)
+	}
+
+	var problems []problem
+	for _, a := range keys {
+		problems = append(problems, lintAlbumArtists(albums[a])...)
+		for _, gap := range trackGaps(albums[a]) {
+			problems = append(problems, problem{Path: a.dir, Code: lintTrackGap, Message: fmt.Sprintf("album %q: %v", a.name, gap)})
+		}
+	}
+	return problems
+}
+
+// lintAlbumArtists reports files of album, whose album artist differs
+// from the most common one. If album has no album artists, artists
+// are compared, so compilations without album artist are reported too.
+func lintAlbumArtists(files []lintFile) []problem {
+	id := "TPE1"
+	for _, f := range files {
+		if f.frame("TPE2") != "" {
+			id = "TPE2"
+			break
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, f := range files {
+		counts[f.frame(id)]++
+	}
+	if len(counts) < 2 {
+		return nil
+	}
+	var common string
+	for artist, n := range counts {
+		if n > counts[common] || n == counts[common] && artist < common {
+			common = artist
+		}
+	}
+
+	var problems []problem
+	for _, f := range files {
+		if artist := f.frame(id); artist != common {
+			problems = append(problems, problem{
+				Path:    f.path,
+				Code:    lintAlbumArtist,
+				Message: fmt.Sprintf("%v %q differs from %q of %v other files of album %q", id, artist, common, counts[common], f.frame("TALB")),
+			})
+		}
+	}
+	return problems
+}
+
+// trackGaps returns descriptions of missing track numbers of every
+// disc of album. The last track is the maximum of numbers and totals.
+// Invalid track numbers are ignored.
+func trackGaps(files []lintFile) []string {
+	type disc struct {
+		tracks map[int]bool
+		last   int
+	}
+	discs := make(map[string]*disc)
+	for _, f := range files {
+		track := f.frame("TRCK")
+		if !validTrack(track) {
+			continue
+		}
+		name := f.frame("TPOS")
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		d := discs[name]
+		if d == nil {
+			d = &disc{tracks: make(map[int]bool)}
+			discs[name] = d
+		}
+		for i, s := range strings.SplitN(track, "/", 2) {
+			n, _ := strconv.Atoi(s)
+			if i == 0 {
+				d.tracks[n] = true
+			}
+			if n > d.last {
+				d.last = n
+			}
+		}
+	}
+
+	names := make([]string, 0, len(discs))
+	for name := range discs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var gaps []string
+	for _, name := range names {
+		d := discs[name]
+		var missing []string
+		for n := 1; n <= d.last; n++ {
+			if !d.tracks[n] {
+				missing = append(missing, strconv.Itoa(n))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		gap := "missing tracks " + strings.Join(missing, ", ")
+		if name != "" {
+			gap = "disc " + name + ": " + gap
+		}
+		gaps = append(gaps, gap)
+	}
+	return gaps
+}
+
+// validTrack reports whether track is text of TRCK frame with number
+// or number/total, which are not greater than maxTrack.
+func validTrack(track string) bool {
+	if !positionValue.MatchString(track) {
+		return false
+	}
+	for _, s := range strings.SplitN(track, "/", 2) {
+		if n, err := strconv.Atoi(s); err != nil || n > maxTrack {
+			return false
+		}
+	}
+	return true
+}
+
+// lintFlags returns flags of "tagrep lint" command.
+func lintFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("lint", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep lint [flags] paths
+
+Checks tags of files for common problems and prints them as
+"path: code: message" or, with --format json, as JSON objects with
+path, code and message per line. Codes are:
+
+  %-17v frame of --require is missing or empty
+  %-17v album artist differs within album
+  %-17v track numbers of album have gaps
+  %-17v track number is not number or number/total up to %v
+  %-17v text has invalid UTF-8 or replacement characters
+  %-17v UTF-8 text is stored as ISO-8859-1
+  %-17v year is not a number
+  %-17v year is before %v or in future
+
+Album is files with the same album in the same directory. Problems of
+albums are reported for directory. Exits with code 1, if there are
+problems. For example:
+
+  tagrep lint -r --disable track-gap --format json /music
+
+Frames flags restrict files, which are checked. If no frames are
+given, all files are checked.
+
+Flags:
+`, lintMissingFrame, lintAlbumArtist, lintTrackGap, lintInvalidTrack, maxTrack,
+			lintInvalidText, lintMojibake, lintInvalidYear, lintImplausibleYear, minYear)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	flags.StringSliceVar(&flagDisable, "disable", nil, "codes of problems, which aren't reported")
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.StringVar(&flagFormat, "format", "text", "output format: text or json")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.StringSliceVar(&flagRequire, "require", []string{"TPE1", "TIT2", "TALB", "TRCK"}, "IDs of frames, which files must have")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
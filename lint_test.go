@@ -0,0 +1,58 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrackGaps(t *testing.T) {
+	file := func(track, disc string) lintFile {
+		return lintFile{frames: map[string][]string{"TRCK": {track}, "TPOS": {disc}}}
+	}
+	tests := []struct {
+		files []lintFile
+		want  []string
+	}{
+		{[]lintFile{file("1", ""), file("2", "")}, nil},
+		{[]lintFile{file("1", ""), file("3", "")}, []string{"missing tracks 2"}},
+		{[]lintFile{file("1/3", ""), file("2", "")}, []string{"missing tracks 3"}},
+		{
+			[]lintFile{file("2", "1/2"), file("1", "2/2")},
+			[]string{"disc 1: missing tracks 1"},
+		},
+		// Invalid and too large numbers are ignored.
+		{[]lintFile{file("1", ""), file("x", ""), file("2147483647", "")}, nil},
+		{[]lintFile{file("1", ""), file("2/99999999", "")}, nil},
+	}
+	for _, tt := range tests {
+		if got := trackGaps(tt.files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("trackGaps(%v) = %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestValidTrack(t *testing.T) {
+	tests := []struct {
+		track string
+		want  bool
+	}{
+		{"1", true},
+		{"03/12", true},
+		{"999/999", true},
+		{"1000", false},
+		{"1/1000", false},
+		{"99999999999999999999", false},
+		{"", false},
+		{"1/", false},
+		{"a", false},
+	}
+	for _, tt := range tests {
+		if got := validTrack(tt.track); got != tt.want {
+			t.Errorf("validTrack(%q) = %v, want %v", tt.track, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// logLevels are levels of --log-level keyed by their names.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// addLogFlags adds --log-format and --log-level to flags of every command.
+func addLogFlags(flags *pflag.FlagSet) {
+	if flags.Lookup("log-format") != nil {
+		return
+	}
+	flags.StringVar(&flagLogFormat, "log-format", "text", "format of logs written to stderr: text or json")
+	flags.StringVar(&flagLogLevel, "log-level", "info", "minimum level of logs: debug, info, warn or error")
+}
+
+// initLogging sets default logger by --log-format and --log-level.
+func initLogging() {
+	level, ok := logLevels[flagLogLevel]
+	if !ok {
+		fmt.Println("ERROR: --log-level must be debug, info, warn or error")
+		os.Exit(errorStatus)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch flagLogFormat {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		fmt.Println("ERROR: --log-format must be text or json")
+		os.Exit(errorStatus)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// addOnErrorFlag adds --on-error to flags of commands, which scan files.
+func addOnErrorFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&flagOnError, "on-error", "warn", "what to do with unreadable files and directories: skip them silently, warn about them or fail at the first of them")
+}
+
+// logFileError logs error of processing file in path, unless --on-error
+// is skip. It reports whether command must stop by --on-error fail.
+// Commands exit with errorStatus then, after cleaning up.
+func logFileError(path string, err error) bool {
+	if flagOnError == "skip" {
+		return false
+	}
+	logError(path, err)
+	return flagOnError == "fail"
+}
+
+// logFileWarning logs problem of file in path, which is processed still.
+func logFileWarning(path string, err error) {
+	slog.Warn("problem of file", "path", path, "err", err)
+}
+
+// logError logs error of processing file in path regardless of --on-error.
+func logError(path string, err error) {
+	slog.Error("can't process file", "path", path, "err", err)
+}
+
+// fatal logs error with msg and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(errorStatus)
+}
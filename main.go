@@ -5,204 +5,332 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
-	"sync/atomic"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
 var (
 	// Flag values.
-	flagArtist, flagTitle, flagYear                     string
-	flagAbs, flagRecursive, flagIgnoreCase, flagVerbose bool
-	flagExts                                            []string
-
-	// For internal usage.
-	inExts       map[string]bool
-	tagPool      = sync.Pool{New: func() interface{} { return id3v2.NewEmptyTag() }}
-	total, found int64
-	wd           string
+	flagArtist, flagTitle, flagYear, flagIndex           string
+	flagGenre                                            string
+	flagAddr, flagGRPCAddr                               string
+	flagColor, flagFormat, flagPreset                    string
+	flagMusicBrainzURL, flagAcoustIDKey, flagAcoustIDURL string
+	flagFpcalc, flagDest, flagTemplate, flagWhere        string
+	flagSQLite, flagCSV, flagImage, flagCheckpoint       string
+	flagCopyTo, flagMoveTo, flagLinkTo                   string
+	flagPlay, flagMPDMusicDir, flagMetricsAddr           string
+	flagLogFormat, flagLogLevel, flagOnError             string
+	flagNotifyURL, flagExec, flagExecBatch               string
+	flagAbs, flagRecursive, flagIgnoreCase, flagVerbose  bool
+	flagMmap, flagNull, flagPrint0, flagUseIndex         bool
+	flagDryRun, flagLargest, flagFromFolder, flagJSON    bool
+	flagKeepDirs, flagWatch, flagListAll, flagFzf        bool
+	flagOneline, flagNotify, flagStdin, flagShow         bool
+	flagFuzzy, flagShowScore                             bool
+	flagXattrCache, flagNice, flagFingerprint, flagHash  bool
+	flagExts, flagProfile, flagFrames                    []string
+	flagRequire, flagDisable, flagMatch, flagPlugins     []string
+	flagMaxCount, flagMaxSize, flagMaxTagSize            int64
+	flagJobs                                             int
+	flagFileTimeout, flagTolerance                       time.Duration
 )
 
+// niceReadRate is the maximum rate of reading files
+// in bytes per second with --nice.
+const niceReadRate = 2 * 1024 * 1024
+
 func main() {
-	pflag.Usage = func() {
-		fmt.Fprintf(os.Stderr, `Usage:
-  tagrep [flags] paths
-
-Flags:
-`)
-		pflag.PrintDefaults()
-	}
-
-	pflag.BoolVar(&flagAbs, "abs", false, "print absolute paths")
-	pflag.StringVar(&flagArtist, "artist", "", "match artist")
-	pflag.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
-	pflag.BoolVarP(&flagIgnoreCase, "ignore-case", "i", false, "ignore case on matching frames")
-	pflag.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
-	pflag.StringVar(&flagTitle, "title", "", "match title")
-	pflag.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
-	pflag.StringVar(&flagYear, "year", "", "match year")
-	pflag.Parse()
-
-	dirs := pflag.Args()
-	if len(dirs) == 0 {
-		fmt.Println("ERROR: enter at least one path")
-		pflag.Usage()
-		os.Exit(1)
-	}
-
-	if flagAbs {
-		var err error
-		wd, err = os.Getwd()
-		if err != nil {
-			log.Fatalln(err)
-		}
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		runComplete(os.Args[2:])
+		return
 	}
 
-	initOptions()
-
-	if len(flagExts) > 0 && flagExts[0] != "*" {
-		inExts = make(map[string]bool, len(flagExts))
-		for _, ext := range flagExts {
-			inExts[ext] = true
+	var cmd *command
+	if len(os.Args) > 1 {
+		cmd = findCommand(os.Args[1])
+		if os.Args[1] == "--version" {
+			cmd = findCommand("version")
 		}
 	}
+	if cmd == nil || cmd.name == "search" {
+		errorStatus = 2
+	}
 
-	var wg sync.WaitGroup
-	t := time.Now()
-	for _, dir := range dirs {
-		wg.Add(1)
-		go search(dir, &wg)
+	// Config must be loaded before flags of command are created,
+	// because it creates flags of all commands for checking keys.
+	loadConfig()
+
+	if cmd != nil {
+		cmd.run(os.Args[2:])
+		return
 	}
-	wg.Wait()
-	expired := time.Since(t)
 
-	fmt.Printf("%v files total, %v found in %vms\n", total, found, int(1000*expired.Seconds()))
+	// Bare "tagrep [flags] paths" is an alias for "tagrep search".
+	runSearch(os.Args[1:])
 }
 
-var opts = id3v2.Options{
-	Parse: true,
+// errorStatus is exit status of failed command. It's 2 for search
+// like in grep, because 1 means that no files are found.
+var errorStatus = 1
+
+// command is a subcommand of tagrep.
+type command struct {
+	name  string
+	short string
+	run   func(args []string)
+	// flags returns flags of command.
+	flags func() *pflag.FlagSet
+	// args are words, which can be the first argument of command
+	// (e.g. "update" for "index"). They're used for completion.
+	args []string
 }
 
-func initOptions() {
-	if flagArtist != "" {
-		opts.ParseFrames = append(opts.ParseFrames, "Artist")
-	}
-	if flagTitle != "" {
-		opts.ParseFrames = append(opts.ParseFrames, "Title")
-	}
-	if flagYear != "" {
-		opts.ParseFrames = append(opts.ParseFrames, "Year")
-	}
-	if len(opts.ParseFrames) == 0 {
-		// No frames to parse. Exit.
-		os.Exit(0)
+// commands are subcommands of tagrep in order of appearance in usage.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "search", short: "search files with given frames (default command)", run: runSearch, flags: searchFlags},
+		{name: "show", short: "print all frames of files", run: runShow, flags: showFlags},
+		{name: "index", short: "manage index of tags", run: runIndex, flags: indexFlags, args: []string{"update"}},
+		{name: "enrich", short: "compare tags of files with MusicBrainz", run: runEnrich, flags: enrichFlags},
+		{name: "dupes", short: "find duplicate files", run: runDupes, flags: dupesFlags},
+		{name: "diff", short: "compare tracks in two directories by tags", run: runDiff, flags: diffFlags},
+		{name: "lint", short: "check tags for common problems", run: runLint, flags: lintFlags},
+		{name: "rename", short: "rename and move files by their tags", run: runRename, flags: renameFlags},
+		{name: "set", short: "set frames of files matching query", run: runSet, flags: setTagFlags},
+		{name: "strip", short: "delete frames from files", run: runStrip, flags: stripFlags},
+		{name: "normalize", short: "rewrite tags to ID3v2.4 with UTF-8", run: runNormalize, flags: normalizeFlags},
+		{name: "export", short: "export frames of files to SQLite", run: runExport, flags: exportFlags},
+		{name: "import", short: "set frames of files from CSV", run: runImport, flags: importFlags},
+		{name: "playlists", short: "regenerate smart playlists", run: runPlaylists, flags: playlistsFlags, args: playlistsCommands},
+		{name: "art", short: "extract and embed attached pictures", run: runArt, flags: artFlags, args: artCommands},
+		{name: "serve", short: "serve HTTP API for searching", run: runServe, flags: serveFlags},
+		{name: "tui", short: "browse files interactively", run: runTUI, flags: tuiFlags},
+		{name: "watch", short: "print files with given frames as they are added or modified", run: runWatch, flags: watchFlags},
+		{name: "completion", short: "print shell completion script", run: runCompletion, flags: completionFlags, args: shells},
+		{name: "version", short: "print version and supported tag formats", run: runVersion, flags: versionFlags},
 	}
 }
 
-func search(dir string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	fileInfos, err := readDir(dir)
-	if err != nil {
-		log.Fatal(err)
+// findCommand returns command with given name or nil, if there is no such.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
+	return nil
+}
 
-	for _, fi := range fileInfos {
-		path := filepath.Join(dir, fi.Name())
-
-		if fi.IsDir() {
-			if flagRecursive {
-				wg.Add(1)
-				go search(path, wg)
-			}
-			continue
+// printCommands prints list of commands to stderr.
+func printCommands() {
+	width := 0
+	for _, cmd := range commands {
+		if len(cmd.name) > width {
+			width = len(cmd.name)
 		}
+	}
 
-		atomic.AddInt64(&total, 1)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-*v  %v\n", width, cmd.name, cmd.short)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun \"tagrep <command> --help\" for help on command.")
+}
 
-		// Check if file is more than 20 bytes.
-		// It makes no sense to parse file less than 20 bytes,
-		// because header of ID3v2 tag and of one frame header equal to 20 bytes.
-		if fi.Size() < 20 {
-			continue
-		}
+// addQueryFlags adds flags of matching frames and --preset to flags.
+func addQueryFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&flagArtist, "artist", "", "match artist")
+	flags.BoolVar(&flagFuzzy, "fuzzy", false, "match artist, title and genre by similarity ignoring case and typos")
+	flags.BoolVarP(&flagIgnoreCase, "ignore-case", "i", false, "ignore case on matching frames")
+	flags.StringVar(&flagTitle, "title", "", "match title")
+	flags.StringVar(&flagYear, "year", "", "match year")
+	flags.StringVar(&flagGenre, "genre", "", `match genre. references to ID3v1 genres like "(17)" match their names`)
+	addDateFlags(flags)
+	flags.StringArrayVar(&flagMatch, "match", nil, `match frames with registered matcher given as NAME=ARG (e.g. "regexp=Artist=^Queen")`)
+	flags.StringSliceVar(&flagPlugins, "plugin", nil, "load Go plugins registering matchers and tag formats")
+	flags.StringVar(&flagPreset, "preset", "", "take flags from given preset in config")
+}
 
-		if len(inExts) > 0 && !inExts[filepath.Ext(fi.Name())] {
-			continue
-		}
+// addListAllFlag adds --list-all to flags of commands, which require
+// criteria without it.
+func addListAllFlag(flags *pflag.FlagSet) {
+	flags.BoolVar(&flagListAll, "list-all", false, "find all files with artist, title or year instead of matching criteria")
+}
 
-		wg.Add(1)
-		go match(path, wg)
+// checkQuery exits with usage of flags, if q has no criteria
+// and --list-all is not set or if it has them with --list-all.
+func checkQuery(flags *pflag.FlagSet, q tagrep.Query) {
+	if q.IsEmpty() && !flagListAll {
+		fmt.Println("ERROR: enter at least one of --artist, --title, --year, --genre and --match or --list-all to find all tagged files")
+		flags.Usage()
+		os.Exit(errorStatus)
+	}
+	if !q.IsEmpty() && flagListAll {
+		fmt.Println("ERROR: --list-all can't be used with --artist, --title, --year, --genre and --match")
+		os.Exit(errorStatus)
 	}
 }
 
-// Copy of ioutil.ReadDir but just without sort.
-func readDir(dirname string) ([]os.FileInfo, error) {
-	f, err := os.Open(dirname)
-	if err != nil {
-		return nil, err
+// flagQuery returns query built from flags added by addQueryFlags.
+func flagQuery() tagrep.Query {
+	return tagrep.Query{
+		Artist:     flagArtist,
+		Title:      flagTitle,
+		Year:       flagYear,
+		Genre:      flagGenre,
+		IgnoreCase: flagIgnoreCase,
+		Fuzzy:      flagFuzzy,
+		Matchers:   append(flagMatchers(), dateMatchers()...),
 	}
-	defer f.Close()
-	return f.Readdir(-1)
 }
 
-func match(path string, wg *sync.WaitGroup) {
-	defer wg.Done()
+// useColor reports whether output must be colored by --color.
+func useColor() bool {
+	switch flagColor {
+	case "always":
+		return true
+	case "never":
+		return false
+	case "auto":
+		return os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+	}
+	fmt.Println("ERROR: --color must be auto, always or never")
+	os.Exit(errorStatus)
+	return false
+}
 
-	// Open file.
-	file, err := os.Open(path)
-	if err != nil {
-		if flagVerbose {
-			log.Println("ERROR: ", path, ":", err)
+// newScanner returns scanner configured by flags common for all commands.
+func newScanner() *tagrep.Scanner {
+	if flagMmap && !tagrep.MmapSupported {
+		fmt.Println("ERROR: --mmap is not supported on this platform")
+		os.Exit(errorStatus)
+	}
+
+	s := &tagrep.Scanner{
+		Jobs:          flagJobs,
+		FileTimeout:   flagFileTimeout,
+		MaxTagSize:    flagMaxTagSize,
+		OnWarning:     logFileWarning,
+		Mmap:          flagMmap,
+		NullSeparated: flagNull,
+	}
+
+	if len(flagExts) > 0 && flagExts[0] != "*" {
+		s.Exts = flagExts
+	}
+
+	if flagNice {
+		s.ReadRate = niceReadRate
+		if s.Jobs <= 0 {
+			s.Jobs = 1
+		}
+		if err := lowerPriority(); err != nil && flagVerbose {
+			slog.Warn("can't lower priority", "err", err)
 		}
-		return
 	}
-	defer file.Close()
 
-	// Acquire tag from pool and find in file the ID3v2 tag.
-	tag := tagPool.Get().(*id3v2.Tag)
-	defer tagPool.Put(tag)
-	if err := tag.Reset(file, opts); err != nil {
+	switch flagOnError {
+	case "skip":
+	case "warn":
+		s.OnError = logError
+	case "fail":
+		// Scan is stopped gracefully instead of exiting by logFileError.
+		s.OnError = logError
+		s.FailOnError = true
+	case "":
+		// Commands without --on-error log errors only with --verbose.
 		if flagVerbose {
-			log.Println("ERROR: ", path, ":", err)
+			s.OnError = logError
 		}
-		return
+	default:
+		fmt.Println("ERROR: --on-error must be skip, warn or fail")
+		os.Exit(errorStatus)
 	}
 
-	if !tag.HasFrames() {
-		return
+	return s
+}
+
+// checkScanErrors exits with errorStatus, if some files or directories
+// couldn't be read in scan with stats, unless --on-error is skip.
+func checkScanErrors(stats tagrep.Stats) {
+	if status := scanErrorsStatus(stats); status != 0 {
+		os.Exit(status)
 	}
+}
 
-	if flagArtist != "" && !areStringsEqual(tag.Artist(), flagArtist, flagIgnoreCase) {
-		return
+// scanErrorsStatus logs and returns errorStatus, if some files or
+// directories couldn't be read in scan with stats, unless --on-error
+// is skip. Otherwise it returns 0.
+func scanErrorsStatus(stats tagrep.Stats) int {
+	if stats.Errors == 0 || flagOnError == "skip" {
+		return 0
 	}
-	if flagTitle != "" && !areStringsEqual(tag.Title(), flagTitle, flagIgnoreCase) {
-		return
+	slog.Error("files and directories couldn't be read", "errors", stats.Errors)
+	return errorStatus
+}
+
+// interruptContext returns context, which is canceled on SIGINT or SIGTERM,
+// so scan can be stopped gracefully. The next signal kills process.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// interruptedStatus is exit status of interrupted scan
+// like shells have after SIGINT.
+const interruptedStatus = 130
+
+// printInterrupted prints to w where interrupted scan with stats stopped.
+func printInterrupted(w io.Writer, stats tagrep.Stats) {
+	msg := "Interrupted"
+	if stats.LastPath != "" {
+		msg += ", scan stopped after " + stats.LastPath
 	}
-	if flagYear != "" && !areStringsEqual(tag.Year(), flagYear, flagIgnoreCase) {
-		return
+	if flagCheckpoint != "" {
+		msg += ", resume it with the same --checkpoint"
 	}
+	fmt.Fprintln(w, msg)
+}
 
-	atomic.AddInt64(&found, 1)
-
-	if flagAbs && !filepath.IsAbs(path) {
-		fmt.Println(filepath.Join(wd, path))
-	} else {
-		fmt.Println(path)
+// openIndex opens index in --index.
+func openIndex() *tagrep.Index {
+	if flagIndex == "" {
+		flagIndex = tagrep.DefaultIndexPath()
+	}
+	idx, err := tagrep.OpenIndex(flagIndex)
+	if err != nil {
+		fatal("can't open index", err)
 	}
+	return idx
 }
 
-func areStringsEqual(a, b string, ignoreCase bool) bool {
-	if ignoreCase {
-		return strings.EqualFold(a, b)
+// initProfile starts profiling requested by --profile
+// and returns function, which stops it.
+func initProfile() func() {
+	stop, err := startProfile(flagProfile)
+	if err != nil {
+		fatal("can't start profiling", err)
+	}
+	return func() {
+		if err := stop(); err != nil {
+			slog.Error("can't write profile", "err", err)
+		}
 	}
-	return a == b
 }
@@ -0,0 +1,59 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"plugin"
+	"strings"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// flagMatchers loads plugins of --plugin and returns matchers of --match.
+// Plugins register their matchers by tagrep.RegisterMatcher
+// in init functions.
+func flagMatchers() []tagrep.Matcher {
+	loadPlugins()
+
+	var matchers []tagrep.Matcher
+	for _, m := range flagMatch {
+		matcher, err := newMatcher(m)
+		if err != nil {
+			fmt.Printf("ERROR: invalid --match %q: %v\n", m, err)
+			os.Exit(errorStatus)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers
+}
+
+// loadPlugins loads plugins of --plugin.
+func loadPlugins() {
+	for _, path := range flagPlugins {
+		if _, err := plugin.Open(path); err != nil {
+			fmt.Println("ERROR: can't load plugin:", err)
+			os.Exit(errorStatus)
+		}
+	}
+}
+
+// newMatcher creates matcher from m given as NAME=ARG.
+func newMatcher(m string) (tagrep.Matcher, error) {
+	name, arg, _ := strings.Cut(m, "=")
+	matcher, err := tagrep.NewMatcher(name, arg)
+	if err != nil {
+		return nil, fmt.Errorf("%v. matchers are %v", err, strings.Join(tagrep.Matchers(), ", "))
+	}
+	return matcher, nil
+}
+
+// withFrames is a matcher, which matches all files, but makes scanner
+// read its frames.
+type withFrames []string
+
+func (m withFrames) Frames() []string                  { return m }
+func (withFrames) Match(frames map[string]string) bool { return true }
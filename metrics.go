@@ -0,0 +1,130 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// durationBuckets are upper bounds of buckets of histogram
+// of reading durations in seconds.
+var durationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics are metrics of scanner in Prometheus text format
+// served on /metrics by serve and watch.
+type metrics struct {
+	mu      sync.Mutex
+	scanned int64
+	matched int64
+	errors  int64
+	// buckets are counts of durations in durationBuckets
+	// and +Inf bucket, not cumulative.
+	buckets     []int64
+	durationSum float64
+
+	index *tagrep.Index
+}
+
+// newMetrics returns metrics counting files matched by s.
+// With index, its size and time of its last update are reported too.
+func newMetrics(s *tagrep.Scanner) *metrics {
+	m := &metrics{buckets: make([]int64, len(durationBuckets)+1), index: s.Index}
+
+	onError := s.OnError
+	s.OnError = func(path string, err error) {
+		m.mu.Lock()
+		m.errors++
+		m.mu.Unlock()
+		if onError != nil {
+			onError(path, err)
+		}
+	}
+	s.OnMatch = func(path string, matched bool, d time.Duration) {
+		m.observe(matched, d)
+	}
+	return m
+}
+
+// observe counts matched file, which frames were read in d.
+func (m *metrics) observe(matched bool, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scanned++
+	if matched {
+		m.matched++
+	}
+	seconds := d.Seconds()
+	m.durationSum += seconds
+	i := 0
+	for i < len(durationBuckets) && seconds > durationBuckets[i] {
+		i++
+	}
+	m.buckets[i]++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+
+	m.mu.Lock()
+	writeMetric(&b, "tagrep_files_scanned_total", "counter", "Number of files matched against query.", m.scanned)
+	writeMetric(&b, "tagrep_files_matched_total", "counter", "Number of files matching query.", m.matched)
+	writeMetric(&b, "tagrep_errors_total", "counter", "Number of errors of reading files.", m.errors)
+
+	name := "tagrep_read_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %v Time of reading frames of file from file or caches.\n# TYPE %v histogram\n", name, name)
+	var count int64
+	for i, le := range durationBuckets {
+		count += m.buckets[i]
+		fmt.Fprintf(&b, "%v_bucket{le=%q} %v\n", name, strconv.FormatFloat(le, 'g', -1, 64), count)
+	}
+	count += m.buckets[len(durationBuckets)]
+	fmt.Fprintf(&b, "%v_bucket{le=\"+Inf\"} %v\n%v_sum %v\n%v_count %v\n", name, count, name, m.durationSum, name, count)
+	m.mu.Unlock()
+
+	if m.index != nil {
+		n, err := m.index.Len()
+		if err == nil {
+			writeMetric(&b, "tagrep_index_files", "gauge", "Number of files in index.", n)
+		}
+		var updated time.Time
+		if err == nil {
+			updated, err = m.index.Updated()
+		}
+		if err != nil {
+			slog.Error("can't read index", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !updated.IsZero() {
+			writeMetric(&b, "tagrep_index_last_update_timestamp_seconds", "gauge", "Time of the last update of index.", float64(updated.UnixNano())/1e9)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// writeMetric writes metric without labels with name, type typ,
+// help and value to b.
+func writeMetric(b *bytes.Buffer, name, typ, help string, value interface{}) {
+	fmt.Fprintf(b, "# HELP %v %v\n# TYPE %v %v\n%v %v\n", name, help, name, typ, name, value)
+}
+
+// serveMetrics serves m on /metrics of addr.
+func serveMetrics(addr string, m *metrics) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	slog.Info("listening for metrics", "addr", addr)
+	return http.ListenAndServe(addr, mux)
+}
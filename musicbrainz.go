@@ -0,0 +1,193 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mbUserAgent identifies tagrep to MusicBrainz, as it's required by
+	// https://musicbrainz.org/doc/MusicBrainz_API/Rate_Limiting.
+	mbUserAgent = "tagrep (https://github.com/n10v/tagrep)"
+
+	// mbInterval is the minimal interval between requests to MusicBrainz.
+	mbInterval = time.Second
+
+	// mbMinScore is the minimal score of found recording,
+	// at which it's considered the same as file.
+	mbMinScore = 90
+
+	// mbCacheTTL is time, after which cached recordings are refetched.
+	mbCacheTTL = 30 * 24 * time.Hour
+)
+
+// mbRecording is a recording in MusicBrainz.
+type mbRecording struct {
+	ID               string `json:"id"`
+	Score            int    `json:"score"`
+	Title            string `json:"title"`
+	FirstReleaseDate string `json:"first-release-date"`
+	ArtistCredit     []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+	} `json:"artist-credit"`
+}
+
+// Artist returns artist of r as it's credited.
+func (r *mbRecording) Artist() string {
+	var b strings.Builder
+	for _, ac := range r.ArtistCredit {
+		b.WriteString(ac.Name)
+		b.WriteString(ac.JoinPhrase)
+	}
+	return b.String()
+}
+
+// Year returns year of first release of r.
+func (r *mbRecording) Year() string {
+	if len(r.FirstReleaseDate) < 4 {
+		return ""
+	}
+	return r.FirstReleaseDate[:4]
+}
+
+// mbCacheEntry is a cached result of searching recording.
+// Recording is nil, if it's not found.
+type mbCacheEntry struct {
+	Fetched   time.Time    `json:"fetched"`
+	Recording *mbRecording `json:"recording"`
+}
+
+// mbClient searches recordings in MusicBrainz. Requests are rate-limited
+// and their results are cached in file.
+type mbClient struct {
+	url       string
+	client    *http.Client
+	cachePath string
+
+	mu    sync.Mutex
+	next  time.Time
+	cache map[string]mbCacheEntry
+}
+
+// newMBClient returns client of MusicBrainz API at url.
+// Cache is read from and written to cachePath, if it's not empty.
+func newMBClient(url, cachePath string) *mbClient {
+	c := &mbClient{
+		url:       strings.TrimSuffix(url, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+		cachePath: cachePath,
+		cache:     make(map[string]mbCacheEntry),
+	}
+	if cachePath != "" {
+		if b, err := os.ReadFile(cachePath); err == nil {
+			// Broken cache is just refetched.
+			json.Unmarshal(b, &c.cache)
+		}
+	}
+	return c
+}
+
+// defaultMBCachePath returns path of MusicBrainz cache
+// in user's cache directory.
+func defaultMBCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tagrep", "musicbrainz.json")
+}
+
+// recording searches recording with artist and title. If there is no
+// recording with score at least mbMinScore, it returns nil.
+func (c *mbClient) recording(ctx context.Context, artist, title string) (*mbRecording, error) {
+	key := artist + "\x00" + title
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.cache[key]; ok && time.Since(e.Fetched) < mbCacheTTL {
+		return e.Recording, nil
+	}
+
+	if d := time.Until(c.next); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer func() { c.next = time.Now().Add(mbInterval) }()
+
+	q := fmt.Sprintf("artist:%v AND recording:%v", luceneQuote(artist), luceneQuote(title))
+	u := c.url + "/ws/2/recording?fmt=json&limit=1&query=" + url.QueryEscape(q)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", mbUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("musicbrainz: %v", resp.Status)
+	}
+
+	var result struct {
+		Recordings []*mbRecording `json:"recordings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("musicbrainz: %v", err)
+	}
+
+	var rec *mbRecording
+	if len(result.Recordings) > 0 && result.Recordings[0].Score >= mbMinScore {
+		rec = result.Recordings[0]
+	}
+	c.cache[key] = mbCacheEntry{Fetched: time.Now(), Recording: rec}
+	return rec, nil
+}
+
+// saveCache writes cache to c.cachePath.
+func (c *mbClient) saveCache() error {
+	if c.cachePath == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	b, err := json.Marshal(c.cache)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return os.WriteFile(c.cachePath, b, 0644)
+}
+
+// luceneQuote quotes s as a phrase in Lucene query.
+func luceneQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// lowerPriority sets the lowest CPU priority and idle I/O scheduling class
+// for tagrep, so disk is used only when other processes don't need it.
+// Priorities are per thread in Linux, so they are set for every
+// existing thread. New threads inherit them.
+func lowerPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19); err != nil {
+			return err
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid),
+			ioprioClassIdle<<ioprioClassShift)
+		if errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package main
+
+// lowerPriority lowers priority of tagrep. It's supported only on Linux.
+func lowerPriority() error {
+	return nil
+}
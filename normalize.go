@@ -0,0 +1,395 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runNormalize runs "tagrep normalize" command with args.
+func runNormalize(args []string) {
+	flags := normalizeFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	summary := newChangeSummary()
+	files, stats := walkFiles(paths)
+	for _, path := range files {
+		diffs, err := normalizeFileTag(path, flagDryRun)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		summary.change(path, diffs)
+	}
+	summary.print(stats.Total)
+	checkScanErrors(stats)
+}
+
+// rawTag describes ID3v2 tag as it's stored in file.
+type rawTag struct {
+	version byte
+	// size is the size of tag with header, frames and padding.
+	size int64
+	// frames is number of frames in tag.
+	frames int
+	// empty is number of frames with empty bodies. bogem/id3v2
+	// drops them on parsing.
+	empty int
+	// padding is the size of padding after frames.
+	padding int64
+	// unsupported are features of tag, which bogem/id3v2 doesn't
+	// support, so it corrupts frames on rewriting.
+	unsupported []string
+}
+
+// errUnsupportedTag is returned by commands writing tags for files,
+// which can't be written without corrupting frames.
+var errUnsupportedTag = errors.New("tag can't be rewritten")
+
+// rewritable returns error wrapping errUnsupportedTag,
+// if t has unsupported features.
+func (t rawTag) rewritable() error {
+	if len(t.unsupported) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: it has %v", errUnsupportedTag, strings.Join(t.unsupported, ", "))
+}
+
+// checkRewritable returns error wrapping errUnsupportedTag,
+// if tag of file in path can't be rewritten by bogem/id3v2.
+func checkRewritable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	raw, err := readRawTag(f)
+	if err != nil {
+		return err
+	}
+	return raw.rewritable()
+}
+
+// errTagTooLarge is returned for files with ID3v2 tags larger
+// than --max-tag-size.
+var errTagTooLarge = errors.New("tag is larger than maximum tag size")
+
+// checkTagSize returns errTagTooLarge, if ID3v2 tag of file in path
+// is larger than --max-tag-size. bogem/id3v2 reads whole tag to memory,
+// so such tags must not be parsed by it.
+func checkTagSize(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(f, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+	maxTagSize := flagMaxTagSize
+	if maxTagSize <= 0 {
+		maxTagSize = tagrep.DefaultMaxTagSize
+	}
+	if bytes.Equal(header[:3], []byte("ID3")) && synchsafe(header[6:10]) > maxTagSize {
+		return errTagTooLarge
+	}
+	return nil
+}
+
+// Flags of frames, which bogem/id3v2 doesn't support, in ID3v2.3 and ID3v2.4.
+// Group identifier and data length indicator are prepended to data
+// of frame, so bogem/id3v2 would keep them in text of frame.
+var (
+	frameFlagsV3 = []frameFlag{{0x80, "compressed"}, {0x40, "encrypted"}, {0x20, "grouped"}}
+	frameFlagsV4 = []frameFlag{{0x40, "grouped"}, {0x08, "compressed"}, {0x04, "encrypted"}, {0x02, "unsynchronised"}, {0x01, "length-prefixed"}}
+)
+
+// frameFlag is a flag in format flags of frame header.
+type frameFlag struct {
+	mask        byte
+	description string
+}
+
+// readRawTag reads headers of ID3v2 tag and its frames in r.
+// If there is no tag, it returns zero rawTag.
+func readRawTag(r io.ReaderAt) (rawTag, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return rawTag{}, nil
+		}
+		return rawTag{}, err
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return rawTag{}, nil
+	}
+
+	t := rawTag{version: header[3]}
+	if header[5]&0x80 != 0 {
+		t.unsupported = append(t.unsupported, "unsynchronisation")
+	}
+	flags := frameFlagsV3
+	if t.version == 4 {
+		flags = frameFlagsV4
+	}
+	end := 10 + synchsafe(header[6:10])
+	t.size = end
+	if header[5]&0x10 != 0 {
+		t.size += 10
+	}
+
+	offset := int64(10)
+	if header[5]&0x40 != 0 {
+		if _, err := r.ReadAt(header[:4], offset); err != nil {
+			return rawTag{}, err
+		}
+		// In ID3v2.3 size of extended header excludes size bytes.
+		if t.version == 4 {
+			offset += synchsafe(header[:4])
+		} else {
+			offset += 4 + int64(binary.BigEndian.Uint32(header[:4]))
+		}
+	}
+
+	for offset+10 <= end {
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return rawTag{}, err
+		}
+		if header[0] == 0 {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:8]))
+		if t.version == 4 {
+			size = synchsafe(header[4:8])
+		}
+		for _, flag := range flags {
+			if header[9]&flag.mask != 0 {
+				t.unsupported = append(t.unsupported, flag.description+" frame "+string(header[:4]))
+			}
+		}
+		// bogem/id3v2 stops parsing at the first empty frame,
+		// so frames after it would be lost.
+		if size == 0 {
+			t.empty++
+		} else if t.empty > 0 {
+			t.unsupported = append(t.unsupported, "frame "+string(header[:4])+" after empty frame")
+		}
+		t.frames++
+		offset += 10 + size
+	}
+	if offset < end {
+		t.padding = end - offset
+	}
+	return t, nil
+}
+
+// normalizeFileTag rewrites tag of file in path to ID3v2.4 with UTF-8
+// encoding of texts, without padding and duplicate frames. It returns
+// descriptions of changes. If nothing changes or dryRun is set,
+// file is not written.
+func normalizeFileTag(path string, dryRun bool) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readRawTag(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if raw.size == 0 {
+		// No tag.
+		return nil, nil
+	}
+	if err := raw.rewritable(); err != nil {
+		return nil, err
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	// Frames with the same IDs and unique identifiers (e.g. language
+	// and description of comments) replace each other on parsing.
+	// Empty frames are dropped, but not counted as changes.
+	duplicates := raw.frames - raw.empty - tag.Count()
+
+	var diffs []string
+	if raw.version != 4 {
+		diffs = append(diffs, fmt.Sprintf("version: 2.%v -> 2.4", raw.version))
+		diffs = append(diffs, convertToV24(tag)...)
+		tag.SetVersion(4)
+	}
+
+	if n := encodeUTF8(tag); n > 0 {
+		diffs = append(diffs, fmt.Sprintf("encoding: %v frames -> UTF-8", n))
+	}
+
+	if duplicates > 0 {
+		diffs = append(diffs, fmt.Sprintf("duplicate frames: %v removed", duplicates))
+	}
+	if raw.padding > 0 {
+		diffs = append(diffs, fmt.Sprintf("padding: %v bytes removed", raw.padding))
+	}
+
+	if len(diffs) == 0 || dryRun {
+		return diffs, nil
+	}
+	return diffs, tag.Save()
+}
+
+// convertToV24 converts frames of tag, which are changed in ID3v2.4,
+// and returns descriptions of changes. Dates in TYER, TDAT and TIME
+// are joined in TDRC, TORY becomes TDOR. TRDA and TSIZ are deleted.
+func convertToV24(tag *id3v2.Tag) []string {
+	var diffs []string
+	text := func(id string) string {
+		return tag.GetTextFrame(id).Text
+	}
+
+	if year := text("TYER"); year != "" {
+		date := year
+		if d := text("TDAT"); len(d) == 4 {
+			// TDAT is DDMM.
+			date += "-" + d[2:] + "-" + d[:2]
+			if t := text("TIME"); len(t) == 4 {
+				// TIME is HHMM.
+				date += "T" + t[:2] + ":" + t[2:]
+			}
+		}
+		if text("TDRC") == "" {
+			tag.AddTextFrame("TDRC", id3v2.EncodingUTF8, date)
+		}
+		diffs = append(diffs, fmt.Sprintf("TYER: %q -> TDRC: %q", year, text("TDRC")))
+	}
+	if year := text("TORY"); year != "" {
+		if text("TDOR") == "" {
+			tag.AddTextFrame("TDOR", id3v2.EncodingUTF8, year)
+		}
+		diffs = append(diffs, fmt.Sprintf("TORY: %q -> TDOR: %q", year, text("TDOR")))
+	}
+
+	var deleted []string
+	for _, id := range []string{"TYER", "TDAT", "TIME", "TORY", "TRDA", "TSIZ"} {
+		if len(tag.GetFrames(id)) > 0 {
+			tag.DeleteFrames(id)
+			deleted = append(deleted, id)
+		}
+	}
+	if len(deleted) > 0 {
+		diffs = append(diffs, "deleted: "+strings.Join(deleted, ", "))
+	}
+	return diffs
+}
+
+// encodeUTF8 sets UTF-8 encoding of all frames with texts in tag
+// and returns number of changed frames.
+func encodeUTF8(tag *id3v2.Tag) int {
+	utf8 := id3v2.EncodingUTF8
+	tag.SetDefaultEncoding(utf8)
+
+	var n int
+	for id, frames := range tag.AllFrames() {
+		for _, f := range frames {
+			switch fr := f.(type) {
+			case id3v2.TextFrame:
+				if fr.Encoding.Equals(utf8) {
+					continue
+				}
+				fr.Encoding = utf8
+				f = fr
+			case id3v2.CommentFrame:
+				if fr.Encoding.Equals(utf8) {
+					continue
+				}
+				fr.Encoding = utf8
+				f = fr
+			case id3v2.UnsynchronisedLyricsFrame:
+				if fr.Encoding.Equals(utf8) {
+					continue
+				}
+				fr.Encoding = utf8
+				f = fr
+			case id3v2.UserDefinedTextFrame:
+				if fr.Encoding.Equals(utf8) {
+					continue
+				}
+				fr.Encoding = utf8
+				f = fr
+			case id3v2.PictureFrame:
+				if fr.Encoding.Equals(utf8) {
+					continue
+				}
+				fr.Encoding = utf8
+				f = fr
+			default:
+				continue
+			}
+			// Changed frame replaces the original one,
+			// because they have the same unique identifier.
+			tag.AddFrame(id, f)
+			n++
+		}
+	}
+	return n
+}
+
+// normalizeFlags returns flags of "tagrep normalize" command.
+func normalizeFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("normalize", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep normalize [flags] paths
+
+Rewrites tags of files to ID3v2.4 with UTF-8 encoding of texts and
+without padding and duplicate frames. Dates of ID3v2.3 (TYER, TDAT
+and TIME) are joined in TDRC.
+
+Frames flags restrict files, which are normalized. If no frames are
+given, all files are normalized.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// rawTestTag returns ID3v2 tag of version with flags and one TIT2 frame
+// with frame flags.
+func rawTestTag(version, flags, frameFlags byte) []byte {
+	frame := append([]byte{'T', 'I', 'T', '2', 0, 0, 0, 3, 0, frameFlags}, 0, 'a', 'b')
+	tag := append([]byte{'I', 'D', '3', version, 0, flags, 0, 0, 0, byte(len(frame))}, frame...)
+	return append(tag, make([]byte, 128)...)
+}
+
+func TestReadRawTagUnsupported(t *testing.T) {
+	tests := []struct {
+		tag  []byte
+		want []string
+	}{
+		{rawTestTag(3, 0, 0), nil},
+		{rawTestTag(4, 0, 0x01), []string{"length-prefixed frame TIT2"}},
+		{rawTestTag(3, 0x80, 0), []string{"unsynchronisation"}},
+		{rawTestTag(3, 0, 0x80), []string{"compressed frame TIT2"}},
+		{rawTestTag(3, 0, 0x40), []string{"encrypted frame TIT2"}},
+		{rawTestTag(3, 0, 0x20), []string{"grouped frame TIT2"}},
+		{rawTestTag(4, 0, 0x40), []string{"grouped frame TIT2"}},
+		{rawTestTag(4, 0, 0x08), []string{"compressed frame TIT2"}},
+		{rawTestTag(4, 0, 0x04), []string{"encrypted frame TIT2"}},
+		{rawTestTag(4, 0x80, 0x02), []string{"unsynchronisation", "unsynchronised frame TIT2"}},
+	}
+	for _, tt := range tests {
+		raw, err := readRawTag(bytes.NewReader(tt.tag))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.frames != 1 {
+			t.Errorf("%v frames in %x, want 1", raw.frames, tt.tag[:20])
+		}
+		if !reflect.DeepEqual(raw.unsupported, tt.want) {
+			t.Errorf("unsupported features of %x are %q, want %q", tt.tag[:20], raw.unsupported, tt.want)
+		}
+		if err := raw.rewritable(); (err != nil) != (tt.want != nil) {
+			t.Errorf("rewritable of %x returned %v", tt.tag[:20], err)
+		}
+	}
+}
+
+func TestUnsupportedTagNotWritten(t *testing.T) {
+	for _, frameFlags := range []byte{0x08, 0x40, 0x01} {
+		testUnsupportedTagNotWritten(t, rawTestTag(4, 0, frameFlags))
+	}
+}
+
+func testUnsupportedTagNotWritten(t *testing.T, data []byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := setFrames(path, map[string]string{"title": "x"}, false, false); !errors.Is(err, errUnsupportedTag) {
+		t.Errorf("setFrames returned %v, want errUnsupportedTag", err)
+	}
+	if _, _, err := stripFrames(path, []string{"TIT2"}, false); !errors.Is(err, errUnsupportedTag) {
+		t.Errorf("stripFrames returned %v, want errUnsupportedTag", err)
+	}
+	if _, err := normalizeFileTag(path, false); !errors.Is(err, errUnsupportedTag) {
+		t.Errorf("normalizeFileTag returned %v, want errUnsupportedTag", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("file is changed")
+	}
+}
+
+func TestNormalizeEmptyFrame(t *testing.T) {
+	title := []byte{'T', 'I', 'T', '2', 0, 0, 0, 3, 0, 0, 3, 'a', 'b'}
+	empty := []byte{'T', 'P', 'E', '1', 0, 0, 0, 0, 0, 0}
+	tag := func(frames ...[]byte) []byte {
+		body := bytes.Join(frames, nil)
+		data := append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, byte(len(body))}, body...)
+		return append(data, make([]byte, 128)...)
+	}
+
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	data := tag(title, empty)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := normalizeFileTag(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("tag with empty frame is normalized: %q", diffs)
+	}
+
+	raw, err := readRawTag(bytes.NewReader(tag(empty, title)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"frame TIT2 after empty frame"}; !reflect.DeepEqual(raw.unsupported, want) {
+		t.Errorf("unsupported features are %q, want %q", raw.unsupported, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// notifyClient is a client of webhooks of --notify-url.
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifyWebhook posts r to url as JSON object like results of serve.
+func notifyWebhook(url string, r tagrep.Result) error {
+	body, err := json.Marshal(searchResult{
+		Path:    r.AbsPath,
+		Size:    r.Info.Size(),
+		ModTime: r.Info.ModTime(),
+		Frames:  r.Frames,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with %v", resp.Status)
+	}
+	return nil
+}
+
+// errNotifyUnsupported is returned by checkDesktopNotify, if desktop
+// notifications are not supported on this platform.
+var errNotifyUnsupported = errors.New("desktop notifications are supported only on Linux, BSD and macOS")
+
+// checkDesktopNotify returns error, if desktop notifications can't be shown.
+func checkDesktopNotify() error {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := exec.LookPath("osascript")
+		return err
+	case "windows", "plan9", "js", "wasip1", "ios", "android":
+		return errNotifyUnsupported
+	default:
+		_, err := exec.LookPath("notify-send")
+		return err
+	}
+}
+
+// notifyDesktop shows desktop notification about r by notify-send
+// or, on macOS, by osascript.
+func notifyDesktop(r tagrep.Result) error {
+	title := "tagrep: new file"
+	text := strings.Join(nonEmpty(r.Frames["Artist"], r.Frames["Title"]), " - ")
+	if text == "" {
+		text = r.Path
+	} else {
+		text += "\n" + r.Path
+	}
+	text = strings.ReplaceAll(text, tagrep.ValueSeparator, ", ")
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		script := "display notification " + strconv.Quote(text) + " with title " + strconv.Quote(title)
+		cmd = exec.Command("osascript", "-e", script)
+	} else {
+		cmd = exec.Command("notify-send", "--app-name=tagrep", "--", title, text)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// nonEmpty returns non-empty strings of ss.
+func nonEmpty(ss ...string) []string {
+	var res []string
+	for _, s := range ss {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// play plays files with player given by --play. "mpd" enqueues them
+// in MPD, other players are run with files as arguments.
+func play(files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Strings(files)
+	if flagPlay == "mpd" {
+		return enqueueMPD(files)
+	}
+
+	cmd := exec.Command(flagPlay, files...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// enqueueMPD adds files to queue of MPD at address given by MPD_HOST
+// and MPD_PORT like in mpc. Files are added relative to --mpd-music-dir
+// or as file:// URIs, which MPD accepts only over local socket.
+func enqueueMPD(files []string) error {
+	uris := make([]string, len(files))
+	for i, path := range files {
+		uri, err := mpdURI(path)
+		if err != nil {
+			return err
+		}
+		uris[i] = uri
+	}
+
+	network, addr, password := mpdAddr()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		return fmt.Errorf("%v is not MPD", addr)
+	}
+
+	w := bufio.NewWriter(conn)
+	if password != "" {
+		fmt.Fprintf(w, "password %v\n", mpdQuote(password))
+	}
+	fmt.Fprintln(w, "command_list_begin")
+	for _, uri := range uris {
+		fmt.Fprintf(w, "add %v\n", mpdQuote(uri))
+	}
+	fmt.Fprintln(w, "command_list_end")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	responses := 1
+	if password != "" {
+		responses++
+	}
+	for i := 0; i < responses; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ACK ") {
+			return errors.New("mpd: " + line[len("ACK "):])
+		}
+	}
+	return nil
+}
+
+// mpdURI returns URI of file in path for MPD.
+func mpdURI(path string) (string, error) {
+	if strings.ContainsRune(path, '\n') {
+		// Commands of MPD are lines.
+		return "", fmt.Errorf("%q can't be added to MPD: path contains newline", path)
+	}
+	if isURL(path) {
+		return path, nil
+	}
+	if flagMPDMusicDir == "" {
+		return "file://" + path, nil
+	}
+	dir, err := filepath.Abs(flagMPDMusicDir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%v is not in --mpd-music-dir %v", path, flagMPDMusicDir)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// mpdAddr returns network, address and password of MPD from MPD_HOST
+// and MPD_PORT. MPD_HOST may be "password@host" or path of socket.
+func mpdAddr() (network, addr, password string) {
+	host, port := os.Getenv("MPD_HOST"), os.Getenv("MPD_PORT")
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		password, host = host[:i], host[i+1:]
+	}
+	if strings.HasPrefix(host, "/") {
+		return "unix", host, password
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6600"
+	}
+	return "tcp", net.JoinHostPort(host, port), password
+}
+
+// mpdQuote quotes s as argument of MPD command.
+func mpdQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
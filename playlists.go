@@ -0,0 +1,445 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// playlistsCommands are subcommands of "tagrep playlists".
+var playlistsCommands = []string{"sync"}
+
+// playlistSortKeys are keys, by which files of playlist can be sorted.
+var playlistSortKeys = []string{"path", "mtime", "size", "artist", "title", "year"}
+
+// playlistSettleDelay is time without changes in watched directories,
+// after which playlists are synced with --watch.
+const playlistSettleDelay = time.Second
+
+// playlistSpec is a smart playlist read from TOML file:
+//
+//	paths = ["~/Music"]
+//	artist = "Queen"
+//	sort = ["year", "title"]
+//	limit = 50
+//	output = "queen.m3u"
+type playlistSpec struct {
+	// Paths are searched paths. Default is paths from config.
+	Paths []string `toml:"paths"`
+	// Recursive is true by default.
+	Recursive  *bool    `toml:"recursive"`
+	Artist     string   `toml:"artist"`
+	Title      string   `toml:"title"`
+	Year       string   `toml:"year"`
+	IgnoreCase bool     `toml:"ignore-case"`
+	Match      []string `toml:"match"`
+	// Sort are playlistSortKeys, by which files are sorted.
+	// Keys prefixed by "-" sort in descending order. Default is path.
+	Sort []string `toml:"sort"`
+	// Limit is the maximum number of files, if it's positive.
+	Limit int `toml:"limit"`
+	// Output is a path of M3U file. Default is path of spec
+	// with extension ".m3u".
+	Output string `toml:"output"`
+
+	query tagrep.Query
+}
+
+// runPlaylists runs "tagrep playlists" command with args.
+func runPlaylists(args []string) {
+	flags := playlistsFlags()
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 || flags.Arg(0) != "sync" {
+		fmt.Println("ERROR: unknown playlists command")
+		flags.Usage()
+		os.Exit(1)
+	}
+	specs := flags.Args()[1:]
+	if len(specs) == 0 {
+		fmt.Println("ERROR: enter at least one playlist spec")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	loadPlugins()
+	var idx *tagrep.Index
+	if flagUseIndex {
+		idx = openIndex()
+		defer idx.Close()
+	}
+
+	syncPlaylists(specs, idx)
+	if flagWatch {
+		if err := watchPlaylists(specs, func() { syncPlaylists(specs, idx) }); err != nil {
+			fatal("can't watch", err)
+		}
+	}
+}
+
+// syncPlaylists regenerates playlists of specs and prints changed ones.
+func syncPlaylists(specs []string, idx *tagrep.Index) {
+	summary := newChangeSummary()
+	for _, path := range specs {
+		spec, err := readPlaylistSpec(path)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		changes, err := syncPlaylist(spec, idx)
+		if err != nil {
+			summary.fail(spec.Output, err)
+			continue
+		}
+		summary.change(spec.Output, changes)
+	}
+	summary.print(int64(len(specs)))
+}
+
+// readPlaylistSpec reads spec of playlist in path. Relative paths
+// in it are relative to directory of path.
+func readPlaylistSpec(path string) (playlistSpec, error) {
+	var spec playlistSpec
+	md, err := toml.DecodeFile(path, &spec)
+	if err != nil {
+		return spec, err
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return spec, fmt.Errorf("unknown key %q", keys[0].String())
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		p = expandHome(p)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		return p
+	}
+	if len(spec.Paths) == 0 {
+		spec.Paths = defaultPaths()
+	}
+	if len(spec.Paths) == 0 {
+		return spec, errors.New("no paths in spec and config")
+	}
+	for i, p := range spec.Paths {
+		spec.Paths[i] = resolve(p)
+	}
+	if spec.Output == "" {
+		spec.Output = strings.TrimSuffix(path, filepath.Ext(path)) + ".m3u"
+	}
+	spec.Output = resolve(spec.Output)
+	if spec.Recursive == nil {
+		recursive := true
+		spec.Recursive = &recursive
+	}
+
+	for _, key := range spec.Sort {
+		if !contains(playlistSortKeys, strings.TrimPrefix(key, "-")) {
+			return spec, fmt.Errorf("unknown sort key %q, keys are %v", key, strings.Join(playlistSortKeys, ", "))
+		}
+	}
+
+	spec.query = tagrep.Query{
+		Artist:     spec.Artist,
+		Title:      spec.Title,
+		Year:       spec.Year,
+		IgnoreCase: spec.IgnoreCase,
+		// Frames for sorting and #EXTINF are read for every file.
+		Matchers: []tagrep.Matcher{withFrames{"Artist", "Title", "Year"}},
+	}
+	for _, m := range spec.Match {
+		matcher, err := newMatcher(m)
+		if err != nil {
+			return spec, fmt.Errorf("invalid match %q: %v", m, err)
+		}
+		spec.query.Matchers = append(spec.query.Matchers, matcher)
+	}
+	return spec, nil
+}
+
+// syncPlaylist regenerates playlist of spec. If content of playlist
+// is changed, it returns changes of it.
+func syncPlaylist(spec playlistSpec, idx *tagrep.Index) ([]string, error) {
+	s := newScanner()
+	s.Recursive = *spec.Recursive
+	s.Query = spec.query
+	s.Index = idx
+
+	var mu sync.Mutex
+	var found []tagrep.Result
+	stats, err := s.Scan(context.Background(), spec.Paths, func(r tagrep.Result) {
+		mu.Lock()
+		found = append(found, r)
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stats.Errors > 0 && flagOnError != "skip" {
+		// Files of playlist may be missed.
+		return nil, fmt.Errorf("%v files and directories couldn't be read", stats.Errors)
+	}
+
+	sortPlaylist(found, spec.Sort)
+	if spec.Limit > 0 && len(found) > spec.Limit {
+		found = found[:spec.Limit]
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(spec.Output))
+	if err != nil {
+		return nil, err
+	}
+	content, paths := m3u(found, dir)
+	old, err := os.ReadFile(spec.Output)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if bytes.Equal(old, content) {
+		return nil, nil
+	}
+
+	oldPaths := make(map[string]bool)
+	for _, line := range strings.Split(string(old), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			oldPaths[line] = true
+		}
+	}
+	var added int
+	for _, path := range paths {
+		if oldPaths[path] {
+			delete(oldPaths, path)
+		} else {
+			added++
+		}
+	}
+
+	if !flagDryRun {
+		if err := writeFileAtomic(spec.Output, content); err != nil {
+			return nil, err
+		}
+	}
+	return []string{fmt.Sprintf("%v files, %v added, %v removed", len(paths), added, len(oldPaths))}, nil
+}
+
+// sortPlaylist sorts files by keys. Files with equal keys are sorted by path.
+func sortPlaylist(files []tagrep.Result, keys []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		for _, key := range keys {
+			desc := strings.HasPrefix(key, "-")
+			if c := comparePlaylistKey(a, b, strings.TrimPrefix(key, "-")); c != 0 {
+				return c < 0 != desc
+			}
+		}
+		return a.AbsPath < b.AbsPath
+	})
+}
+
+// comparePlaylistKey compares files a and b by key.
+func comparePlaylistKey(a, b tagrep.Result, key string) int {
+	switch key {
+	case "path":
+		return strings.Compare(a.AbsPath, b.AbsPath)
+	case "mtime":
+		return a.Info.ModTime().Compare(b.Info.ModTime())
+	case "size":
+		switch {
+		case a.Info.Size() < b.Info.Size():
+			return -1
+		case a.Info.Size() > b.Info.Size():
+			return 1
+		}
+		return 0
+	}
+	description := strings.ToUpper(key[:1]) + key[1:]
+	return strings.Compare(strings.ToLower(a.Frames[description]), strings.ToLower(b.Frames[description]))
+}
+
+// m3u returns content of extended M3U playlist of files and paths in it.
+// Paths are relative to dir of playlist, if it's possible.
+func m3u(files []tagrep.Result, dir string) ([]byte, []string) {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	paths := make([]string, 0, len(files))
+	for _, r := range files {
+		path := r.AbsPath
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		}
+		if strings.ContainsAny(path, "\r\n") {
+			// Lines of M3U can't contain newlines.
+			slog.Warn("path with newline is skipped in playlist", "path", r.AbsPath)
+			continue
+		}
+		paths = append(paths, path)
+
+		title := r.Frames["Title"]
+		if artist := r.Frames["Artist"]; artist != "" {
+			title = artist + " - " + title
+		}
+		fmt.Fprintf(&b, "#EXTINF:-1,%v\n%v\n", title, path)
+	}
+	return b.Bytes(), paths
+}
+
+// writeFileAtomic writes data to file in path through temporary file,
+// so readers never see partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// watchPlaylists watches specs and paths in them and calls update, when
+// they aren't changed for playlistSettleDelay after change.
+// It blocks until error of watching.
+func watchPlaylists(specs []string, update func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// outputs are playlists, changes of which are ignored.
+	outputs := make(map[string]bool)
+	for _, path := range specs {
+		if err := w.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+		spec, err := readPlaylistSpec(path)
+		if err != nil {
+			continue
+		}
+		outputs[spec.Output] = true
+		for _, p := range spec.Paths {
+			if err := watchTree(w, p, *spec.Recursive); err != nil {
+				return err
+			}
+		}
+	}
+
+	timer := time.NewTimer(playlistSettleDelay)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if outputs[ev.Name] || strings.HasPrefix(filepath.Base(ev.Name), ".") {
+				// Playlists and their temporary files.
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					// Only recursive paths get events of subdirectories.
+					if err := watchTree(w, ev.Name, true); err != nil {
+						slog.Error("can't watch", "path", ev.Name, "err", err)
+					}
+				}
+			}
+			timer.Reset(playlistSettleDelay)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Error("can't watch", "err", err)
+		case <-timer.C:
+			update()
+		}
+	}
+}
+
+// watchTree adds path to w. If path is directory and recursive is set,
+// subdirectories are added too.
+func watchTree(w *fsnotify.Watcher, path string, recursive bool) error {
+	if !recursive {
+		return w.Add(path)
+	}
+	return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
+
+// playlistsFlags returns flags of "tagrep playlists" command.
+func playlistsFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("playlists", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep playlists sync [flags] specs
+
+Regenerates M3U playlists from smart playlist specs. Spec is a TOML
+file with query, sort order, limit and path of playlist:
+
+  paths = ["~/Music"]        # default is paths from config
+  recursive = true           # default
+  artist = "Queen"           # also title, year, ignore-case
+  match = ["regexp=Album/Movie/Show title=^Live"]
+  sort = ["-year", "title"]  # path, mtime, size, artist, title, year
+  limit = 50
+  output = "queen.m3u"       # default is spec path with .m3u extension
+
+Relative paths in spec are relative to its directory. Playlists are
+written only if their content is changed. With --watch, playlists are
+regenerated on every change in searched paths and specs.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringSliceVar(&flagPlugins, "plugin", nil, "load Go plugins registering matchers and tag formats")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	flags.BoolVarP(&flagWatch, "watch", "w", false, "regenerate playlists on changes until interrupted")
+	return flags
+}
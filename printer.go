@@ -0,0 +1,63 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// printer prints paths sent from many goroutines. Paths are written to
+// the buffer by a single goroutine, so output is never interleaved.
+// Buffer is flushed when no more paths are waiting to be printed.
+type printer struct {
+	paths chan string
+	done  chan struct{}
+	bw    *bufio.Writer
+	sep   byte
+	err   error
+}
+
+// newPrinter creates printer writing to w paths separated by sep.
+func newPrinter(w io.Writer, sep byte) *printer {
+	p := &printer{
+		paths: make(chan string, 256),
+		done:  make(chan struct{}),
+		bw:    bufio.NewWriter(w),
+		sep:   sep,
+	}
+	go p.loop()
+	return p
+}
+
+func (p *printer) loop() {
+	defer close(p.done)
+	for path := range p.paths {
+		if p.err != nil {
+			continue
+		}
+		p.bw.WriteString(path)
+		p.bw.WriteByte(p.sep)
+		if len(p.paths) == 0 {
+			p.err = p.bw.Flush()
+		}
+	}
+	if p.err == nil {
+		p.err = p.bw.Flush()
+	}
+}
+
+// Print queues path for printing.
+func (p *printer) Print(path string) {
+	p.paths <- path
+}
+
+// Close waits until all queued paths are printed.
+// It returns the first error occurred on writing.
+func (p *printer) Close() error {
+	close(p.paths)
+	<-p.done
+	return p.err
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Files, to which profiles are written.
+const (
+	cpuProfileFile = "tagrep.cpu.pprof"
+	memProfileFile = "tagrep.mem.pprof"
+	traceFile      = "tagrep.trace"
+)
+
+// startProfile starts profiling of given kinds ("cpu", "mem" or "trace")
+// and returns function, which stops profiling and writes profiles to files.
+func startProfile(kinds []string) (stop func() error, err error) {
+	var stops []func() error
+	stop = func() error {
+		var err error
+		for i := len(stops) - 1; i >= 0; i-- {
+			if e := stops[i](); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+
+	for _, kind := range kinds {
+		switch kind {
+		case "cpu":
+			f, err := os.Create(cpuProfileFile)
+			if err != nil {
+				stop()
+				return nil, err
+			}
+			if err := pprof.StartCPUProfile(f); err != nil {
+				f.Close()
+				stop()
+				return nil, err
+			}
+			stops = append(stops, func() error {
+				pprof.StopCPUProfile()
+				return f.Close()
+			})
+		case "mem":
+			stops = append(stops, func() error {
+				f, err := os.Create(memProfileFile)
+				if err != nil {
+					return err
+				}
+				runtime.GC()
+				if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+					f.Close()
+					return err
+				}
+				return f.Close()
+			})
+		case "trace":
+			f, err := os.Create(traceFile)
+			if err != nil {
+				stop()
+				return nil, err
+			}
+			if err := trace.Start(f); err != nil {
+				f.Close()
+				stop()
+				return nil, err
+			}
+			stops = append(stops, func() error {
+				trace.Stop()
+				return f.Close()
+			})
+		default:
+			stop()
+			return nil, fmt.Errorf("unknown profile %q", kind)
+		}
+	}
+
+	return stop, nil
+}
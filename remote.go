@@ -0,0 +1,142 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+)
+
+// remoteClient is a client fetching tags of remote files.
+var remoteClient = &http.Client{Timeout: 30 * time.Second}
+
+// isURL reports whether path is http(s) URL of remote file.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// splitURLs splits paths to URLs of remote files and local paths.
+func splitURLs(paths []string) (urls, local []string) {
+	for _, path := range paths {
+		if isURL(path) {
+			urls = append(urls, path)
+		} else {
+			local = append(local, path)
+		}
+	}
+	return urls, local
+}
+
+// matchURLs matches remote files at urls against query of s and calls
+// found for matched ones like s.Scan. Only tags are fetched by HTTP
+// range requests. It stops, if ctx is canceled or s.MaxCount files
+// are found with stats.
+func matchURLs(ctx context.Context, s *tagrep.Scanner, urls []string, stats *tagrep.Stats, found func(tagrep.Result)) error {
+	for _, url := range urls {
+		if s.MaxCount > 0 && stats.Found >= s.MaxCount {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stats.Total++
+		stats.LastPath = url
+
+		r, matched, err := matchURL(ctx, s, url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			stats.Errors++
+			if logFileError(url, err) {
+				return &tagrep.FileError{Path: url, Err: err}
+			}
+			continue
+		}
+		if matched {
+			stats.Found++
+			found(r)
+		}
+	}
+	return nil
+}
+
+// matchURL matches remote file at url against query of s.
+func matchURL(ctx context.Context, s *tagrep.Scanner, url string) (tagrep.Result, bool, error) {
+	rr := &rangeReader{ctx: ctx, url: url}
+	defer rr.Close()
+	return s.MatchReader(rr, url)
+}
+
+// rangeReader reads remote file at url by HTTP range requests
+// of sizes of reads. If server doesn't support ranges, file is read
+// from the whole response.
+type rangeReader struct {
+	ctx    context.Context
+	url    string
+	offset int64
+	// body is a body of response without range.
+	body io.ReadCloser
+}
+
+func (rr *rangeReader) Read(p []byte) (int, error) {
+	if rr.body != nil {
+		return rr.body.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	req, err := http.NewRequestWithContext(rr.ctx, http.MethodGet, rr.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", mbUserAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", rr.offset, rr.offset+int64(len(p))-1))
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		defer resp.Body.Close()
+		n, err := io.ReadFull(resp.Body, p)
+		rr.offset += int64(n)
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return n, err
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Offset is at the end of file.
+		resp.Body.Close()
+		return 0, io.EOF
+	case http.StatusOK:
+		// Range is ignored, so already read bytes are skipped.
+		if _, err := io.CopyN(io.Discard, resp.Body, rr.offset); err != nil {
+			resp.Body.Close()
+			return 0, err
+		}
+		rr.body = resp.Body
+		return rr.body.Read(p)
+	}
+	resp.Body.Close()
+	return 0, errors.New("server responded with " + resp.Status)
+}
+
+// Close closes response, which is read without range.
+func (rr *rangeReader) Close() error {
+	if rr.body == nil {
+		return nil
+	}
+	return rr.body.Close()
+}
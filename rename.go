@@ -0,0 +1,323 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// templateFields are fields, which can be used in --template.
+var templateFields = []string{"artist", "albumartist", "album", "disc", "track", "title", "year", "genre"}
+
+var templateField = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// templateFrames are IDs of frames, from which templateFields are taken.
+var templateFrames = []string{"TPE1", "TPE2", "TALB", "TPOS", "TRCK", "TIT2", "TYER", "TDRC", "TCON"}
+
+// checkTemplate checks that template has only given fields.
+func checkTemplate(template string, fields []string) error {
+	for _, m := range templateField.FindAllStringSubmatch(template, -1) {
+		if !contains(fields, m[1]) {
+			return fmt.Errorf("unknown field {%v} in template, fields are {%v}", m[1], strings.Join(fields, "}, {"))
+		}
+	}
+	return nil
+}
+
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// readTemplateFields reads values of templateFields from tag of file in path.
+func readTemplateFields(path string) (map[string]string, error) {
+	if err := checkTagSize(path); err != nil {
+		return nil, err
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true, ParseFrames: templateFrames})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+	return tagTemplateFields(tag), nil
+}
+
+// tagTemplateFields returns values of templateFields from tag.
+func tagTemplateFields(tag *id3v2.Tag) map[string]string {
+	return map[string]string{
+		"artist":      templateValue(tag.Artist()),
+		"albumartist": templateValue(tag.GetTextFrame("TPE2").Text),
+		"album":       templateValue(tag.Album()),
+		"disc":        position(templateValue(tag.GetTextFrame("TPOS").Text), 1),
+		"track":       position(templateValue(tag.GetTextFrame("TRCK").Text), 2),
+		"title":       templateValue(tag.Title()),
+		"year":        frameYear(templateValue(tag.Year())),
+		"genre":       templateValue(normalizedText("TCON", tag.Genre())),
+	}
+}
+
+// templateValue returns cleaned text of frame with values joined by ", ".
+func templateValue(text string) string {
+	return strings.Join(tagrep.Values(tagrep.CleanText(text)), ", ")
+}
+
+// frameYear returns year of text of year frame. TDRC of ID3v2.4
+// is a timestamp, e.g. "1975-10-31".
+func frameYear(text string) string {
+	if len(text) > 4 {
+		return text[:4]
+	}
+	return text
+}
+
+// position returns number from frame of position in set (e.g. "3/12")
+// padded with zeros to width.
+func position(s string, width int) string {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return s
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// expandTemplate returns path built from template with fields.
+// Values of fields are sanitized, so they can't add path elements.
+// If used field is empty, it returns error.
+func expandTemplate(template string, fields map[string]string) (string, error) {
+	var err error
+	path := templateField.ReplaceAllStringFunc(template, func(m string) string {
+		name := m[1 : len(m)-1]
+		v := sanitizePathElem(fields[name])
+		if v == "" && err == nil {
+			err = fmt.Errorf("no %v for template", name)
+		}
+		return v
+	})
+	return filepath.FromSlash(path), err
+}
+
+// sanitizePathElem replaces characters, which are not allowed in file
+// names on common file systems, by "_" and trims spaces and dots.
+func sanitizePathElem(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	return strings.Trim(s, " .")
+}
+
+// runRename runs "tagrep rename" command with args.
+func runRename(args []string) {
+	flags := renameFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flagTemplate == "" {
+		fmt.Println("ERROR: enter --template")
+		os.Exit(1)
+	}
+	if err := checkTemplate(flagTemplate, templateFields); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	summary := newChangeSummary()
+	files, stats := walkFiles(paths)
+
+	// taken are destinations of renamed files.
+	taken := make(map[string]bool)
+	for _, path := range files {
+		fields, err := readTemplateFields(path)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		dest, err := expandTemplate(flagTemplate, fields)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(flagDest, dest)
+		}
+
+		dest, err = freePath(path, dest, taken, sameFile)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		taken[dest] = true
+		if sameFile(path, dest) {
+			summary.change(path, nil)
+			continue
+		}
+
+		if !flagDryRun {
+			if err := moveFile(path, dest); err != nil {
+				summary.fail(path, err)
+				continue
+			}
+		}
+		summary.change(path, []string{"-> " + dest})
+	}
+	summary.print(stats.Total)
+	checkScanErrors(stats)
+}
+
+// sameFile reports whether paths a and b are the same file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
+// freePath returns path for moving file src to, which doesn't exist
+// and is not taken. If path is busy, number is added to its name:
+// "Song (2).mp3". If done reports, that src is already at path or
+// at numbered one, it's returned, so renaming is idempotent.
+// If path can't be checked, e.g. its directory is a file,
+// it returns error.
+func freePath(src, path string, taken map[string]bool, done func(src, path string) bool) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		if taken[path] {
+			path = fmt.Sprintf("%v (%v)%v", base, i, ext)
+			continue
+		}
+		if done(src, path) {
+			return path, nil
+		}
+		_, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		path = fmt.Sprintf("%v (%v)%v", base, i, ext)
+	}
+}
+
+// moveFile moves file from src to dest and creates directories of dest.
+// If it can't be renamed, e.g. because dest is on another file system,
+// file is copied and removed.
+func moveFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies file src to dest, which must not exist.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Chtimes(dest, fi.ModTime(), fi.ModTime())
+}
+
+// renameFlags returns flags of "tagrep rename" command.
+func renameFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("rename", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep rename --template TEMPLATE [flags] paths
+
+Renames and moves files by their tags. For example:
+
+  tagrep rename -r --dest /music --template "{artist}/{album}/{track} - {title}.mp3" ~/Downloads
+
+Fields of template are {%v}.
+Track and disc are padded with zeros. Characters, which are not allowed
+in file names, are replaced by "_". Files with empty fields used in
+template are skipped. If file with new name already exists, number is
+added to name: "Song (2).mp3".
+
+Frames flags restrict files, which are renamed. If no frames are given,
+all files are renamed.
+
+Flags:
+`, strings.Join(templateFields, "}, {"))
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	flags.StringVar(&flagDest, "dest", ".", "directory, to which relative template is resolved")
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.StringVar(&flagTemplate, "template", "", "template of new paths of files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadTemplateFieldsMultipleValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	writeTestTag(t, path, map[string]string{
+		"TPE1": "Queen\x00David Bowie\x00",
+		"TIT2": "Under Pressure ",
+		"TCON": "(17)\x00Glam",
+	})
+
+	fields, err := readTemplateFields(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"artist": "Queen, David Bowie",
+		"title":  "Under Pressure",
+		"genre":  "Rock, Glam",
+	}
+	for name, v := range want {
+		if fields[name] != v {
+			t.Errorf("%v is %q, want %q", name, fields[name], v)
+		}
+	}
+}
+
+func TestReadTemplateFieldsMaxTagSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	writeTestTag(t, path, map[string]string{"TIT2": "Under Pressure"})
+
+	defer func(size int64) { flagMaxTagSize = size }(flagMaxTagSize)
+	flagMaxTagSize = 10
+	if _, err := readTemplateFields(path); !errors.Is(err, errTagTooLarge) {
+		t.Errorf("readTemplateFields returned %v, want errTagTooLarge", err)
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runSearch runs "tagrep search" command with args.
+func runSearch(args []string) {
+	if status := search(args); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// search runs "tagrep search" command with args and returns its exit
+// status. Status is returned instead of exiting, so index is closed
+// and profiles are written by deferred calls.
+func search(args []string) int {
+	flags := searchFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if flagStdin {
+		if len(paths) > 0 {
+			fmt.Println("ERROR: paths can't be entered with --stdin")
+			return errorStatus
+		}
+		searchStdin()
+		return 0
+	}
+	if flagShow {
+		fmt.Println("ERROR: --show can be used only with --stdin")
+		return errorStatus
+	}
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		return errorStatus
+	}
+	var urls []string
+	urls, paths = splitURLs(paths)
+
+	if flagXattrCache && !tagrep.XattrSupported {
+		fmt.Println("ERROR: --xattr-cache is not supported on this platform")
+		return errorStatus
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.MaxCount = flagMaxCount
+	s.XattrCache = flagXattrCache
+	s.Query = flagQuery()
+	checkQuery(flags, s.Query)
+
+	if flagUseIndex {
+		s.Index = openIndex()
+		defer s.Index.Close()
+	}
+
+	action, err := flagAction()
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return errorStatus
+	}
+	if flagPlay != "" && action != nil {
+		fmt.Println("ERROR: --play can't be used with --copy-to, --move-to and --link-to")
+		return errorStatus
+	}
+	if action != nil && len(urls) > 0 {
+		fmt.Println("ERROR: remote files can't be copied, moved or linked")
+		return errorStatus
+	}
+	execCmd, err := flagExecCommand(paths)
+	if err != nil {
+		fmt.Println("ERROR: can't run command:", err)
+		return errorStatus
+	}
+	if execCmd != nil {
+		if action != nil || flagPlay != "" {
+			fmt.Println("ERROR: --exec and --exec-batch can't be used with --copy-to, --move-to, --link-to and --play")
+			return errorStatus
+		}
+		s.Query.Matchers = append(s.Query.Matchers, withFrames(execCmd.frames()))
+	}
+
+	if flagCheckpoint != "" {
+		if len(urls) > 0 {
+			fmt.Println("ERROR: --checkpoint can't be used with URLs")
+			return errorStatus
+		}
+		if action != nil || flagPlay != "" || execCmd != nil {
+			// Files found before interruption would be skipped by action.
+			fmt.Println("ERROR: --checkpoint can't be used with --copy-to, --move-to, --link-to, --play, --exec and --exec-batch")
+			return errorStatus
+		}
+		c, err := tagrep.OpenCheckpoint(flagCheckpoint, checkpointKey(paths, s))
+		if err != nil {
+			fmt.Println("ERROR: can't open checkpoint:", err)
+			return errorStatus
+		}
+		s.Checkpoint = c
+	}
+
+	stopProfile := initProfile()
+	defer stopProfile()
+
+	if flagFzf {
+		if flags.Changed("format") && flagFormat != "fzf" {
+			fmt.Println("ERROR: --fzf can't be used with --format", flagFormat)
+			return errorStatus
+		}
+		flagFormat = "fzf"
+	}
+	if flagFormat != "path" && flagFormat != "json" && flagFormat != "fzf" {
+		fmt.Println("ERROR: unknown format", flagFormat)
+		return errorStatus
+	}
+	if flagShowScore && !s.Query.Fuzzy {
+		fmt.Println("ERROR: --show-score can be used only with --fuzzy")
+		return errorStatus
+	}
+	// Colors would get into paths selected in fzf.
+	color := useColor() && flagFormat != "fzf"
+	if flagFormat == "fzf" {
+		// Columns are printed for every file.
+		s.Query.Matchers = append(s.Query.Matchers, withFrames{"Artist", "Title", "Year"})
+	}
+
+	sep := byte('\n')
+	if flagPrint0 {
+		sep = 0
+	}
+	out := newPrinter(os.Stdout, sep)
+
+	// With action or player, found files are collected
+	// and processed after scan. Files found by fuzzy query
+	// are collected and printed by their scores.
+	var mu sync.Mutex
+	var found []string
+	var ranked []rankedResult
+	rank := s.Query.Fuzzy && action == nil && flagPlay == "" && execCmd == nil
+	if rank {
+		// The best files by scores are printed instead of the first found ones.
+		s.MaxCount = 0
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	t := time.Now()
+	process := func(r tagrep.Result) {
+		if execCmd != nil {
+			path := r.Path
+			if flagAbs {
+				path = r.AbsPath
+			}
+			execCmd.run(r, path)
+			return
+		}
+		if action != nil {
+			mu.Lock()
+			found = append(found, r.Path)
+			mu.Unlock()
+			return
+		}
+		if flagPlay != "" {
+			mu.Lock()
+			found = append(found, r.AbsPath)
+			mu.Unlock()
+			return
+		}
+		if flagFormat == "fzf" && strings.Contains(r.Path, "\t") {
+			slog.Warn("path with tab is skipped in fzf format", "path", r.Path)
+			return
+		}
+		if flagFormat == "fzf" && !flagPrint0 && strings.Contains(r.Path, "\n") {
+			// Newline would split line of fzf, if lines aren't separated by NUL.
+			slog.Warn("path with newline is skipped in fzf format without --print0", "path", r.Path)
+			return
+		}
+		if rank {
+			mu.Lock()
+			ranked = append(ranked, rankedResult{r, s.Query.Score(r.Frames)})
+			mu.Unlock()
+			return
+		}
+		out.Print(formatResult(r, 0, color))
+	}
+	var stats tagrep.Stats
+	if len(paths) > 0 {
+		stats, err = s.Scan(ctx, paths, process)
+	}
+	if err == nil && len(urls) > 0 {
+		err = matchURLs(ctx, s, urls, &stats, process)
+	}
+	if s.Checkpoint != nil {
+		// Completed scan isn't resumed.
+		closeCheckpoint := s.Checkpoint.Close
+		if err == nil {
+			closeCheckpoint = s.Checkpoint.Remove
+		}
+		if err := closeCheckpoint(); err != nil {
+			slog.Error("can't write checkpoint", "err", err)
+		}
+	}
+	// Files found before interruption are printed with summary.
+	interrupted := errors.Is(err, context.Canceled)
+	if err != nil && !interrupted {
+		// Files found before failure are printed still.
+		out.Close()
+		slog.Error("can't scan", "err", err)
+		return errorStatus
+	}
+	if action != nil && !interrupted {
+		action.run(paths, found, stats)
+		if status := scanErrorsStatus(stats); status != 0 {
+			return status
+		}
+		return notFoundStatus(stats)
+	}
+	if execCmd != nil && !interrupted {
+		execCmd.flush()
+	}
+	sortRanked(ranked)
+	if flagMaxCount > 0 && int64(len(ranked)) > flagMaxCount {
+		ranked = ranked[:flagMaxCount]
+		stats.Found = flagMaxCount
+	}
+	for _, rr := range ranked {
+		out.Print(formatResult(rr.Result, rr.score, color))
+	}
+	if err := out.Close(); err != nil {
+		slog.Error("can't write output", "err", err)
+		return errorStatus
+	}
+	expired := time.Since(t)
+
+	// Keep stdout parsable in JSON and fzf formats
+	// and separate from output of commands.
+	summary := os.Stdout
+	if flagFormat != "path" || execCmd != nil {
+		summary = os.Stderr
+	}
+	fmt.Fprintf(summary, "%v files total, %v found in %vms\n", stats.Total, stats.Found, int(1000*expired.Seconds()))
+	if interrupted {
+		if action != nil || flagPlay != "" {
+			fmt.Fprintln(summary, "Found files were not processed")
+		}
+		if execCmd != nil && execCmd.batch && len(execCmd.pending) > 0 {
+			fmt.Fprintf(summary, "Command was not run for the last %v found files\n", len(execCmd.pending))
+		}
+		printInterrupted(summary, stats)
+		return interruptedStatus
+	}
+	if status := scanErrorsStatus(stats); status != 0 {
+		return status
+	}
+
+	if execCmd != nil && execCmd.failed > 0 {
+		slog.Error("commands failed", "failed", execCmd.failed)
+		return errorStatus
+	}
+	if flagPlay != "" {
+		if err := play(found); err != nil {
+			fmt.Println("ERROR: can't play files:", err)
+			return errorStatus
+		}
+	}
+	return notFoundStatus(stats)
+}
+
+// searchStdin matches file streamed on stdin against query and prints it
+// as "-" or, with --show, its frames like "tagrep show". Only tag is read
+// from stdin, so its rest may be unread.
+func searchStdin() {
+	data, err := tagrep.ReadTag(os.Stdin, flagMaxTagSize)
+	if err != nil {
+		fmt.Println("ERROR: can't read stdin:", err)
+		os.Exit(errorStatus)
+	}
+
+	s := newScanner()
+	s.Query = flagQuery()
+	r, matched, err := s.MatchReader(bytes.NewReader(data), "-")
+	if err != nil {
+		fmt.Println("ERROR: can't parse stdin:", err)
+		os.Exit(errorStatus)
+	}
+	if !matched && !s.Query.IsEmpty() {
+		os.Exit(1)
+	}
+
+	if !flagShow {
+		if !matched {
+			os.Exit(1)
+		}
+		fmt.Println(formatResult(r, s.Query.Score(r.Frames), false))
+		return
+	}
+	f, err := readShownTag("-", r.Frames, bytes.NewReader(data))
+	if err != nil {
+		fmt.Println("ERROR: can't parse stdin:", err)
+		os.Exit(errorStatus)
+	}
+	if flagFormat == "json" {
+		b, _ := json.Marshal(f)
+		fmt.Println(string(b))
+		return
+	}
+	printShownFile(f)
+}
+
+// notFoundStatus returns status 1 like in grep, if no files are found
+// in scan with stats, and 0 otherwise.
+func notFoundStatus(stats tagrep.Stats) int {
+	if stats.Found == 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkpointKey returns key of checkpoint for scan of paths by s.
+// Checkpoint of search with other paths, query or flags, which change
+// found files, isn't resumed.
+func checkpointKey(paths []string, s *tagrep.Scanner) string {
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		abs[i] = path
+		if path != "-" {
+			abs[i], _ = filepath.Abs(path)
+		}
+	}
+	// Matchers are keyed by their flags.
+	q := s.Query
+	q.Matchers = nil
+	return fmt.Sprintf("paths=%q query=%+v match=%q dates=%q plugins=%q recursive=%v exts=%q", abs, q, flagMatch, dateFlagValues(), flagPlugins, s.Recursive, s.Exts)
+}
+
+// rankedResult is a file found by fuzzy query with its score.
+type rankedResult struct {
+	tagrep.Result
+	score float64
+}
+
+// sortRanked sorts results by scores descending and then by paths.
+func sortRanked(results []rankedResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].Path < results[j].Path
+	})
+}
+
+// formatResult returns r formatted for printing by --format and --abs.
+// With --show-score, score of r is printed too. If color is true,
+// paths are colored.
+func formatResult(r tagrep.Result, score float64, color bool) string {
+	path := r.Path
+	if flagAbs {
+		path = r.AbsPath
+	}
+
+	if flagFormat == "json" {
+		v := struct {
+			Path   string            `json:"path"`
+			Frames map[string]string `json:"frames"`
+			Score  *float64          `json:"score,omitempty"`
+		}{Path: path, Frames: r.Frames}
+		if flagShowScore {
+			v.Score = &score
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	if flagFormat == "fzf" {
+		line := path + "\t" + fzfColumn(r.Frames["Artist"]) + "\t" + fzfColumn(r.Frames["Title"]) + "\t" + fzfColumn(r.Frames["Year"])
+		if flagShowScore {
+			line += "\t" + formatScore(score)
+		}
+		return line
+	}
+
+	if color {
+		path = "\x1b[35m" + path + "\x1b[0m"
+	}
+	if flagShowScore {
+		return formatScore(score) + "\t" + path
+	}
+	return path
+}
+
+// formatScore returns score of fuzzy match for printing.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', 2, 64)
+}
+
+// fzfColumn returns text of frame as column of fzf format: values
+// are separated by commas, tabs and newlines are replaced by spaces.
+func fzfColumn(text string) string {
+	text = strings.Join(tagrep.Values(text), ", ")
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(text)
+}
+
+// searchFlags returns flags of "tagrep search" command.
+func searchFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("search", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep [flags] paths
+  tagrep search [flags] paths
+  tagrep <command> [flags] [args]
+
+Use "-" as path to read paths from stdin. http(s) URLs are matched
+by fetching only tags of remote files with range requests. With
+--stdin, file streamed on stdin (e.g. from curl) is matched and
+printed as "-".
+
+`)
+		printCommands()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	addListAllFlag(flags)
+	flags.BoolVar(&flagAbs, "abs", false, "print absolute paths")
+	flags.StringVar(&flagCheckpoint, "checkpoint", "", "record progress of scan to given file and resume interrupted scan from it")
+	flags.StringVar(&flagCopyTo, "copy-to", "", "copy found files to given directory")
+	flags.StringVar(&flagColor, "color", "auto", "color paths: auto, always or never. auto colors them, if stdout is terminal and NO_COLOR is not set")
+	flags.StringVar(&flagExec, "exec", "", `run given command for every found file like in find, e.g. 'mpv {} ;'. {} is replaced by path, {artist} and other fields of rename templates by values of frames`)
+	flags.StringVar(&flagExecBatch, "exec-batch", "", `run given command for found files in batches like xargs, e.g. 'mpv {} +'. {} is replaced by paths`)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.StringVar(&flagFormat, "format", "path", "output format: path, json (JSON object with path and frames per line) or fzf (path, artist, title and year separated by tabs)")
+	flags.BoolVar(&flagFzf, "fzf", false, "shorthand for --format fzf")
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVar(&flagKeepDirs, "keep-dirs", false, "keep paths of files relative to searched paths with --copy-to, --move-to and --link-to")
+	flags.StringVar(&flagLinkTo, "link-to", "", "hard link found files to given directory")
+	addDryRunFlag(flags)
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.Int64VarP(&flagMaxCount, "max-count", "m", 0, "stop after given number of found files. with --fuzzy, print given number of files with the best scores")
+	flags.BoolVar(&flagShowScore, "show-score", false, "print similarity scores of files found by --fuzzy")
+	flags.BoolVar(&flagShow, "show", false, `print all frames of file read by --stdin like "tagrep show"`)
+	flags.BoolVar(&flagStdin, "stdin", false, "match single file streamed on stdin instead of files in paths")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.StringVar(&flagMoveTo, "move-to", "", "move found files to given directory")
+	flags.BoolVar(&flagNice, "nice", false, "low-impact mode: throttle reading, use one job and lowest CPU and I/O priority")
+	flags.BoolVarP(&flagNull, "null", "0", false, `paths read from stdin are separated by NUL instead of newline (use with "find -print0")`)
+	flags.BoolVar(&flagPrint0, "print0", false, "separate printed paths by NUL instead of newline")
+	flags.StringVar(&flagPlay, "play", "", `play found files with given player (e.g. mpv or vlc) or add them to queue of MPD with "mpd"`)
+	flags.StringVar(&flagMPDMusicDir, "mpd-music-dir", "", "music directory of MPD, relative to which files are added with --play mpd (default is adding file:// URIs)")
+	flags.StringSliceVar(&flagProfile, "profile", nil, "write given profiles (cpu, mem, trace) to tagrep.* files in current directory")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	flags.BoolVar(&flagXattrCache, "xattr-cache", false, "cache tags in extended attributes of files (user.tagrep.*)")
+	return flags
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runServe runs "tagrep serve" command with args.
+func runServe(args []string) {
+	flags := serveFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		if path == "-" {
+			fmt.Println("ERROR: serve can't read paths from stdin")
+			os.Exit(1)
+		}
+	}
+
+	if flagXattrCache && !tagrep.XattrSupported {
+		fmt.Println("ERROR: --xattr-cache is not supported on this platform")
+		os.Exit(1)
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.XattrCache = flagXattrCache
+	if flagUseIndex {
+		s.Index = openIndex()
+		defer s.Index.Close()
+	}
+
+	if flagAddr == "" && flagGRPCAddr == "" {
+		fmt.Println("ERROR: enter --addr or --grpc-addr")
+		os.Exit(1)
+	}
+
+	m := newMetrics(s)
+	errc := make(chan error, 3)
+	if flagAddr != "" {
+		http.Handle("/search", &searchHandler{scanner: s, paths: paths})
+		http.Handle("/file", &fileHandler{paths: paths, exts: s.Exts})
+		http.Handle("/", webHandler())
+		if flagMetricsAddr == "" {
+			http.Handle("/metrics", m)
+		}
+		slog.Info("listening for HTTP", "addr", flagAddr)
+		go func() { errc <- http.ListenAndServe(flagAddr, nil) }()
+	}
+	if flagGRPCAddr != "" {
+		slog.Info("listening for gRPC", "addr", flagGRPCAddr)
+		go func() { errc <- serveGRPC(flagGRPCAddr, s, paths) }()
+	}
+	if flagMetricsAddr != "" {
+		go func() { errc <- serveMetrics(flagMetricsAddr, m) }()
+	}
+	fatal("can't serve", <-errc)
+}
+
+// serveFlags returns flags of "tagrep serve" command.
+func serveFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep serve [flags] paths
+
+Serves HTTP API for searching files in paths:
+
+  GET /search?artist=Queen&year=1975
+
+Query parameters are artist, title, year, ignore-case and max-count.
+Found files are returned as JSON.
+
+Web UI for searching, playing and downloading found files and exporting
+them to M3U, CSV and JSON is served on /.
+
+With --grpc-addr, gRPC API described in tagreppb/tagrep.proto
+is served too.
+
+Metrics of scans in Prometheus format are served on /metrics
+of --addr or of --metrics-addr.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&flagAddr, "addr", "localhost:8080", `address to listen on for HTTP API. use "" for disabling it`)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.StringVar(&flagGRPCAddr, "grpc-addr", "", "address to listen on for gRPC API")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.StringVar(&flagMetricsAddr, "metrics-addr", "", "address to serve /metrics on (default is --addr)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	flags.BoolVar(&flagXattrCache, "xattr-cache", false, "cache tags in extended attributes of files (user.tagrep.*)")
+	return flags
+}
+
+// searchHandler serves searches in paths with scanner.
+type searchHandler struct {
+	scanner *tagrep.Scanner
+	paths   []string
+}
+
+// searchResponse is a response of searchHandler.
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+	Total   int64          `json:"total"`
+	Found   int64          `json:"found"`
+}
+
+// searchResult is a found file in searchResponse.
+type searchResult struct {
+	Path    string            `json:"path"`
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"mtime"`
+	Frames  map[string]string `json:"frames"`
+}
+
+func (h *searchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	v := r.URL.Query()
+	ignoreCase, _ := strconv.ParseBool(v.Get("ignore-case"))
+	q := tagrep.Query{
+		Artist:     v.Get("artist"),
+		Title:      v.Get("title"),
+		Year:       v.Get("year"),
+		IgnoreCase: ignoreCase,
+	}
+	if q.IsEmpty() {
+		writeJSONError(w, http.StatusBadRequest, "enter at least one of artist, title and year")
+		return
+	}
+
+	var maxCount int64
+	if m := v.Get("max-count"); m != "" {
+		n, err := strconv.ParseInt(m, 10, 64)
+		if err != nil || n < 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid max-count")
+			return
+		}
+		maxCount = n
+	}
+
+	// Copy scanner, because requests are served concurrently.
+	s := *h.scanner
+	s.Query = q
+	s.MaxCount = maxCount
+
+	var mu sync.Mutex
+	resp := searchResponse{Results: []searchResult{}}
+	stats, err := s.Scan(r.Context(), h.paths, func(res tagrep.Result) {
+		mu.Lock()
+		resp.Results = append(resp.Results, searchResult{
+			Path:    res.AbsPath,
+			Size:    res.Info.Size(),
+			ModTime: res.Info.ModTime(),
+			Frames:  res.Frames,
+		})
+		mu.Unlock()
+	})
+	if err != nil {
+		if r.Context().Err() == nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	resp.Total, resp.Found = stats.Total, stats.Found
+
+	// Files are found in parallel, so sort them for stable responses.
+	sort.Slice(resp.Results, func(i, j int) bool {
+		return resp.Results[i].Path < resp.Results[j].Path
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil && flagVerbose {
+		slog.Error("can't write response", "err", err)
+	}
+}
+
+// writeJSONError writes error with message msg and HTTP status code to w.
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
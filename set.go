@@ -0,0 +1,265 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// settableFrames are descriptions of frames set by "tagrep set"
+// keyed by names of flags.
+var settableFrames = map[string]string{
+	"album":       "Album/Movie/Show title",
+	"albumartist": "Band/Orchestra/Accompaniment",
+	"artist":      "Artist",
+	"disc":        "Part of a set",
+	"genre":       "Content type",
+	"title":       "Title/Songname/Content description",
+	"track":       "Track number/Position in set",
+	"year":        "Year",
+}
+
+// flagSetValues are values of flags of "tagrep set" keyed by names of flags.
+var flagSetValues = make(map[string]*string)
+
+// runSet runs "tagrep set" command with args.
+func runSet(args []string) {
+	flags := setTagFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	// Only changed flags are set, so empty value deletes frame.
+	values := make(map[string]string)
+	for name := range settableFrames {
+		if flags.Changed(name) {
+			values[name] = *flagSetValues[name]
+		}
+	}
+	if len(values) == 0 {
+		fmt.Println("ERROR: enter at least one frame to set")
+		os.Exit(1)
+	}
+
+	query, err := parseWhere(flagWhere)
+	if err != nil {
+		fmt.Println("ERROR: invalid --where:", err)
+		os.Exit(1)
+	}
+	if query.IsEmpty() {
+		fmt.Println("ERROR: enter --where")
+		os.Exit(1)
+	}
+	query.IgnoreCase = flagIgnoreCase
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.Query = query
+
+	summary := newChangeSummary()
+
+	// Collect files first, so they're changed and printed in stable order.
+	var mu sync.Mutex
+	var files []string
+	stats, err := s.Scan(context.Background(), paths, func(r tagrep.Result) {
+		mu.Lock()
+		files = append(files, r.Path)
+		mu.Unlock()
+	})
+	if err != nil {
+		fatal("can't scan", err)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		diffs, err := setFrames(path, values, false, flagDryRun)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		summary.change(path, diffs)
+	}
+	summary.print(stats.Total, fmt.Sprintf("%v found", stats.Found))
+	checkScanErrors(stats)
+}
+
+// setFrames sets frames of file in path to values keyed by names of
+// flags and returns descriptions of changes. Empty value deletes frame.
+// If exported is set, values equal to frames read by readFrameLines
+// don't change them, so unedited exported values are kept as they are.
+// If nothing changes or dryRun is set, file is not written.
+func setFrames(path string, values map[string]string, exported, dryRun bool) ([]string, error) {
+	if err := checkRewritable(path); err != nil {
+		return nil, err
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		id := tag.CommonID(settableFrames[name])
+		old, value := tag.GetTextFrame(id).Text, values[name]
+		if old == value || exported && normalizedText(id, old) == value {
+			continue
+		}
+		if id == "TYER" && value != "" && !yearValue.MatchString(value) {
+			// TYER of ID3v2.3 is always four digits unlike TDRC of ID3v2.4.
+			return nil, fmt.Errorf("invalid year %q, ID3v2.3 tag takes only YYYY", value)
+		}
+		diffs = append(diffs, fmt.Sprintf("%v: %q -> %q", id, old, value))
+		if value == "" {
+			tag.DeleteFrames(id)
+		} else {
+			tag.AddTextFrame(id, textEncoding(tag), value)
+		}
+	}
+
+	if len(diffs) == 0 || dryRun {
+		return diffs, nil
+	}
+	return diffs, tag.Save()
+}
+
+// textEncoding returns encoding of text frames written to tag.
+// ID3v2.3 has no UTF-8, and its default ISO-8859-1 can't encode
+// most of non-Latin texts, so UTF-16 is used there.
+func textEncoding(tag *id3v2.Tag) id3v2.Encoding {
+	if tag.Version() == 3 {
+		return id3v2.EncodingUTF16
+	}
+	return id3v2.EncodingUTF8
+}
+
+// parseWhere parses query like `artist="Stars of the Lid" year=2001`.
+// Values with spaces must be quoted. Quotes and backslashes
+// in quoted values are escaped by backslash.
+func parseWhere(s string) (tagrep.Query, error) {
+	var q tagrep.Query
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return q, nil
+		}
+
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return q, fmt.Errorf("no value of %q", s)
+		}
+		key := s[:i]
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return q, errors.New("unterminated quote")
+			}
+			value, s = b.String(), s[i+1:]
+		} else {
+			i := strings.IndexAny(s, " \t")
+			if i < 0 {
+				i = len(s)
+			}
+			value, s = s[:i], s[i:]
+		}
+
+		switch key {
+		case "artist":
+			q.Artist = value
+		case "title":
+			q.Title = value
+		case "year":
+			q.Year = value
+		case "genre":
+			q.Genre = value
+		default:
+			return q, fmt.Errorf("unknown key %q, keys are artist, title, year and genre", key)
+		}
+	}
+}
+
+// setTagFlags returns flags of "tagrep set" command.
+func setTagFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("set", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep set [frames] --where QUERY [flags] paths
+
+Sets frames of files matching query. For example:
+
+  tagrep set --genre "Ambient" --where 'artist="Stars of the Lid"' -r /music
+
+Query has keys artist, title, year and genre. Values with spaces
+must be quoted. Empty value of frame deletes it.
+
+Frames:
+`)
+		frames := pflag.NewFlagSet("frames", pflag.ContinueOnError)
+		other := pflag.NewFlagSet("other", pflag.ContinueOnError)
+		flags.VisitAll(func(f *pflag.Flag) {
+			if _, ok := settableFrames[f.Name]; ok {
+				frames.AddFlag(f)
+			} else {
+				other.AddFlag(f)
+			}
+		})
+		frames.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		other.PrintDefaults()
+	}
+
+	for name := range settableFrames {
+		v := new(string)
+		flagSetValues[name] = v
+		flags.StringVar(v, name, "", "set "+name)
+		// Defaults of query flags in config must not set frames.
+		flags.SetAnnotation(name, noConfig, []string{"true"})
+	}
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.BoolVarP(&flagIgnoreCase, "ignore-case", "i", false, "ignore case on matching query")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	flags.StringVar(&flagWhere, "where", "", `query of files to set frames of (e.g. 'artist="Queen" year=1975')`)
+	return flags
+}
@@ -0,0 +1,313 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf16"
+
+	"github.com/bogem/id3v2"
+	"github.com/spf13/pflag"
+)
+
+// encodingNames are short names of encodings of frames keyed by their keys.
+var encodingNames = map[byte]string{
+	0: "ISO-8859-1",
+	1: "UTF-16",
+	2: "UTF-16BE",
+	3: "UTF-8",
+}
+
+// pictureTypes are names of types of attached pictures.
+var pictureTypes = []string{
+	"other", "file icon", "other file icon", "front cover", "back cover",
+	"leaflet page", "media", "lead artist", "artist", "conductor", "band",
+	"composer", "lyricist", "recording location", "during recording",
+	"during performance", "screen capture", "bright coloured fish",
+	"illustration", "band logotype", "publisher logotype",
+}
+
+// shownFile is a file printed by "tagrep show".
+type shownFile struct {
+	Path    string `json:"path"`
+	Version int    `json:"version,omitempty"`
+	Size    int64  `json:"size"`
+	Padding int64  `json:"padding"`
+	// Matched are frames, against which query of search is matched.
+	Matched map[string]string `json:"matched"`
+	Frames  []shownFrame      `json:"frames"`
+}
+
+// shownFrame is a frame printed by "tagrep show".
+type shownFrame struct {
+	ID       string `json:"id"`
+	Encoding string `json:"encoding,omitempty"`
+	Size     int    `json:"size"`
+	Text     string `json:"text"`
+}
+
+// runShow runs "tagrep show" command with args.
+func runShow(args []string) {
+	flags := showFlags()
+	parseFlags(flags, args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("ERROR: enter at least one file")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if flagJSON && flagOneline {
+		fmt.Println("ERROR: --json can't be used with --oneline")
+		os.Exit(1)
+	}
+
+	var failed bool
+	for i, path := range flags.Args() {
+		f, err := readShownFile(path)
+		if err != nil {
+			if logFileError(path, err) {
+				os.Exit(errorStatus)
+			}
+			failed = true
+			continue
+		}
+		if flagJSON {
+			b, _ := json.Marshal(f)
+			fmt.Println(string(b))
+			continue
+		}
+		if flagOneline {
+			fmt.Println(shownLine(f))
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printShownFile(f)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readShownFile reads tag and all frames of file in path.
+func readShownFile(path string) (shownFile, error) {
+	r, err := newScanner().Stat(context.Background(), path)
+	if err != nil {
+		return shownFile{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return shownFile{}, err
+	}
+	defer file.Close()
+	return readShownTag(path, r.Frames, file)
+}
+
+// readShownTag reads tag and all frames of file in path from r
+// positioned at the beginning of file. matched are frames of file
+// matched by search.
+func readShownTag(path string, matched map[string]string, r interface {
+	io.Reader
+	io.ReaderAt
+}) (shownFile, error) {
+	f := shownFile{Path: path, Matched: matched}
+	raw, err := readRawTag(r)
+	if err != nil {
+		return shownFile{}, err
+	}
+	f.Version, f.Size, f.Padding = int(raw.version), raw.size, raw.padding
+
+	tag, err := id3v2.ParseReader(r, id3v2.Options{Parse: true})
+	if err != nil {
+		return shownFile{}, err
+	}
+
+	all := tag.AllFrames()
+	for _, id := range sortedFrameIDs(all) {
+		for _, fr := range all[id] {
+			f.Frames = append(f.Frames, shownFrame{ID: id, Encoding: frameEncoding(id, fr), Size: fr.Size(), Text: showFrameText(id, fr)})
+		}
+	}
+	return f, nil
+}
+
+// printShownFile prints f as header and table of frames.
+func printShownFile(f shownFile) {
+	fmt.Println(f.Path)
+	if f.Version == 0 {
+		fmt.Println("  tag: none")
+	} else {
+		fmt.Printf("  tag: ID3v2.%v, %v bytes, %v frames, %v bytes of padding\n", f.Version, f.Size, len(f.Frames), f.Padding)
+	}
+	fmt.Printf("  matched: artist %q, title %q, year %q\n", f.Matched["Artist"], f.Matched["Title"], f.Matched["Year"])
+	if len(f.Frames) == 0 {
+		return
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ID\tENCODING\tSIZE\tTEXT")
+	for _, fr := range f.Frames {
+		enc := fr.Encoding
+		if enc == "" {
+			enc = "-"
+		}
+		fmt.Fprintf(w, "  %v\t%v\t%v\t%v\n", fr.ID, enc, fr.Size, fr.Text)
+	}
+	w.Flush()
+}
+
+// shownLine returns f as one line of path, version of tag and frames
+// as ID=TEXT separated by tabs, e.g. for preview in fzf.
+func shownLine(f shownFile) string {
+	tag := "no tag"
+	if f.Version != 0 {
+		tag = fmt.Sprintf("ID3v2.%v", f.Version)
+	}
+	fields := []string{f.Path, tag}
+	for _, fr := range f.Frames {
+		fields = append(fields, fr.ID+"="+fzfColumn(fr.Text))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// frameEncoding returns name of encoding of frame f with given id.
+// If f has no encoding, it returns "".
+func frameEncoding(id string, f id3v2.Framer) string {
+	var enc id3v2.Encoding
+	switch f := f.(type) {
+	case id3v2.TextFrame:
+		enc = f.Encoding
+	case id3v2.CommentFrame:
+		enc = f.Encoding
+	case id3v2.UnsynchronisedLyricsFrame:
+		enc = f.Encoding
+	case id3v2.UserDefinedTextFrame:
+		enc = f.Encoding
+	case id3v2.PictureFrame:
+		enc = f.Encoding
+	case id3v2.UnknownFrame:
+		if id == "GEOB" && len(f.Body) > 0 {
+			return encodingNames[f.Body[0]]
+		}
+		return ""
+	default:
+		return ""
+	}
+	return encodingNames[enc.Key]
+}
+
+// showFrameText returns text of frame f with given id. Unlike frameText,
+// pictures and general encapsulated objects are described in detail.
+func showFrameText(id string, f id3v2.Framer) string {
+	switch f := f.(type) {
+	case id3v2.PictureFrame:
+		typ := "unknown type"
+		if int(f.PictureType) < len(pictureTypes) {
+			typ = pictureTypes[f.PictureType]
+		}
+		dims := "unknown dimensions"
+		if c, _, err := image.DecodeConfig(bytes.NewReader(f.Picture)); err == nil {
+			dims = fmt.Sprintf("%vx%v", c.Width, c.Height)
+		}
+		return fmt.Sprintf("%v, %v, %q, %v, %v bytes", f.MimeType, typ, f.Description, dims, len(f.Picture))
+	case id3v2.UnknownFrame:
+		if id == "GEOB" {
+			return geobText(f.Body)
+		}
+	}
+	return frameText(f)
+}
+
+// geobText returns description of body of GEOB frame:
+// MIME type, file name, description and size of object.
+func geobText(body []byte) string {
+	if len(body) == 0 {
+		return "empty"
+	}
+	enc, rest := body[0], body[1:]
+	mimeType, rest := splitTerminated(rest, 0)
+	filename, rest := splitTerminated(rest, enc)
+	desc, object := splitTerminated(rest, enc)
+	return fmt.Sprintf("%v, %q, %q, %v bytes", decodeGEOBText(mimeType, 0), decodeGEOBText(filename, enc), decodeGEOBText(desc, enc), len(object))
+}
+
+// splitTerminated splits b in string terminated like in encoding enc
+// and the rest after termination.
+func splitTerminated(b []byte, enc byte) ([]byte, []byte) {
+	if enc != 1 && enc != 2 {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return b[:i], b[i+1:]
+		}
+		return b, nil
+	}
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			return b[:i], b[i+2:]
+		}
+	}
+	return b, nil
+}
+
+// decodeGEOBText decodes b in encoding enc to UTF-8.
+func decodeGEOBText(b []byte, enc byte) string {
+	switch enc {
+	case 1, 2:
+		bigEndian := enc == 2
+		if len(b) >= 2 && (b[0] == 0xfe && b[1] == 0xff || b[0] == 0xff && b[1] == 0xfe) {
+			bigEndian, b = b[0] == 0xfe, b[2:]
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if bigEndian {
+				u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			} else {
+				u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+			}
+		}
+		return string(utf16.Decode(u))
+	case 3:
+		return string(b)
+	}
+	// ISO-8859-1 maps bytes to the same code points.
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// showFlags returns flags of "tagrep show" command.
+func showFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("show", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep show [flags] files
+
+Prints version and size of tag of files, frames, against which query
+of search is matched, and table of all frames with their IDs,
+encodings, sizes in bytes and texts. Attached pictures and general
+encapsulated objects are summarized.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	flags.BoolVar(&flagJSON, "json", false, "print JSON object with path, version, size, padding, matched and frames per file")
+	flags.BoolVar(&flagOneline, "oneline", false, "print path, version of tag and frames as ID=TEXT separated by tabs in one line per file")
+	return flags
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bogem/id3v2"
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runStrip runs "tagrep strip" command with args.
+func runStrip(args []string) {
+	flags := stripFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	if len(flagFrames) == 0 {
+		fmt.Println("ERROR: enter --frames")
+		os.Exit(1)
+	}
+	for _, id := range flagFrames {
+		if len(id) != 4 {
+			fmt.Printf("ERROR: invalid frame ID %q\n", id)
+			os.Exit(1)
+		}
+	}
+
+	summary := newChangeSummary()
+	files, stats := walkFiles(paths)
+	var saved int
+	for _, path := range files {
+		diffs, size, err := stripFrames(path, flagFrames, flagDryRun)
+		if err != nil {
+			summary.fail(path, err)
+			continue
+		}
+		saved += size
+		summary.change(path, diffs)
+	}
+	summary.print(stats.Total, fmt.Sprintf("%v bytes of frames removed", saved))
+	checkScanErrors(stats)
+}
+
+// stripFrames deletes frames with ids from file in path. It returns
+// descriptions of deleted frames and their size with headers.
+// If there are no such frames or dryRun is set, file is not written.
+func stripFrames(path string, ids []string, dryRun bool) ([]string, int, error) {
+	if err := checkRewritable(path); err != nil {
+		return nil, 0, err
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tag.Close()
+
+	var diffs []string
+	var size int
+	for _, id := range ids {
+		frames := tag.GetFrames(id)
+		if len(frames) == 0 {
+			continue
+		}
+		n := 0
+		for _, f := range frames {
+			n += frameHeaderSize + f.Size()
+		}
+		size += n
+		diffs = append(diffs, fmt.Sprintf("%v: %v frames, %v bytes", id, len(frames), n))
+		tag.DeleteFrames(id)
+	}
+
+	if len(diffs) == 0 || dryRun {
+		return diffs, size, nil
+	}
+	return diffs, size, tag.Save()
+}
+
+// frameHeaderSize is the size of header of ID3v2 frame.
+const frameHeaderSize = 10
+
+// stripFlags returns flags of "tagrep strip" command.
+func stripFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("strip", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep strip --frames IDS [flags] paths
+
+Deletes frames with given IDs from files. For example, comments,
+private frames and attached pictures:
+
+  tagrep strip --frames COMM,PRIV,APIC --artist Queen -r /music
+
+Frames flags restrict files, which are changed. If no frames are given,
+all files are changed.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	addDryRunFlag(flags)
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.StringSliceVar(&flagFrames, "frames", nil, "IDs of frames to delete (e.g. COMM,PRIV,APIC)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// checkpointHeader is the first line of checkpoint file before its key.
+const checkpointHeader = "tagrep checkpoint 1 "
+
+// checkpointInterval is how often processed files are written
+// to checkpoint file.
+const checkpointInterval = 5 * time.Second
+
+// ErrCheckpointMismatch is returned by OpenCheckpoint, if checkpoint
+// in path was recorded for scan with another key.
+var ErrCheckpointMismatch = errors.New("checkpoint is recorded for another scan")
+
+// Checkpoint records files processed by Scan to file, so interrupted scan
+// can be resumed. Files are written to file every few seconds and on Close,
+// so at most last few seconds of scan are repeated on resume.
+//
+// Every line of file after header is "+" or "-" followed by quoted
+// absolute path of found or not found file.
+type Checkpoint struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	flushed time.Time
+	done    map[string]bool
+	found   int64
+	// err is the first error of writing file.
+	err error
+}
+
+// OpenCheckpoint opens checkpoint in path. If there is no checkpoint,
+// it creates it. key identifies scan (e.g. its paths and query), so
+// checkpoint isn't resumed by another scan.
+func OpenCheckpoint(path, key string) (*Checkpoint, error) {
+	c := &Checkpoint{done: make(map[string]bool), flushed: time.Now()}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return nil, err
+		}
+		c.file, c.w = file, bufio.NewWriter(file)
+		fmt.Fprintln(c.w, checkpointHeader+strconv.Quote(key))
+		return c, c.w.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.read(file, key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	c.file, c.w = file, bufio.NewWriter(file)
+	return c, nil
+}
+
+// read reads processed files from file of checkpoint with key.
+// Incomplete last line of interrupted write is ignored.
+func (c *Checkpoint) read(file *os.File, key string) error {
+	sc := bufio.NewScanner(file)
+	sc.Buffer(nil, 1<<20)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		return ErrCheckpointMismatch
+	}
+	if sc.Text() != checkpointHeader+strconv.Quote(key) {
+		return ErrCheckpointMismatch
+	}
+
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		path, err := strconv.Unquote(line[1:])
+		if err != nil || line[0] != '+' && line[0] != '-' {
+			continue
+		}
+		if c.done[path] {
+			continue
+		}
+		c.done[path] = true
+		if line[0] == '+' {
+			c.found++
+		}
+	}
+	return sc.Err()
+}
+
+// isDone reports whether file in absolute path is processed.
+func (c *Checkpoint) isDone(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[path]
+}
+
+// add records processed file in absolute path.
+// Errors of writing are returned by Close.
+func (c *Checkpoint) add(path string, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := "-"
+	if found {
+		prefix = "+"
+	}
+	c.w.WriteString(prefix + strconv.Quote(path) + "\n")
+	if time.Since(c.flushed) < checkpointInterval {
+		return
+	}
+	c.flushed = time.Now()
+	if err := c.w.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// Close writes recorded files and closes checkpoint. It returns
+// the first error of writing checkpoint.
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.w.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+	if err := c.file.Close(); err != nil && c.err == nil {
+		c.err = err
+	}
+	return c.err
+}
+
+// Remove closes checkpoint and removes its file.
+// It's used, when scan is completed.
+func (c *Checkpoint) Remove() error {
+	c.Close()
+	return os.Remove(c.file.Name())
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// TagReader reads frames of files of some format.
+type TagReader interface {
+	// ReadFrames returns texts of frames with given descriptions
+	// (e.g. "Artist") keyed by descriptions from rs positioned at
+	// the beginning of file. Formats without ID3v2 frames map their
+	// fields to descriptions of ID3v2 frames. If file has no tag,
+	// it returns nil map and nil error. It may be called from several
+	// goroutines at the same time.
+	ReadFrames(rs io.ReadSeeker, descriptions []string) (map[string]string, error)
+}
+
+// TagFormat is a format of files, which are read by Reader.
+type TagFormat struct {
+	// Name is a name of format (e.g. "flac").
+	Name string
+
+	// Signatures are prefixes of content of files of format
+	// (e.g. "fLaC").
+	Signatures []string
+
+	// Exts are extensions of files of format (e.g. ".flac"). They're
+	// matched like Scanner.Exts, if no signature of any format matches.
+	Exts []string
+
+	Reader TagReader
+}
+
+// TagReaderFunc is a function, which is TagReader.
+type TagReaderFunc func(rs io.ReadSeeker, descriptions []string) (map[string]string, error)
+
+func (f TagReaderFunc) ReadFrames(rs io.ReadSeeker, descriptions []string) (map[string]string, error) {
+	return f(rs, descriptions)
+}
+
+// maxSignatureSize is the maximum size of signature of TagFormat.
+const maxSignatureSize = 32
+
+var (
+	formatsMu sync.RWMutex
+	// formats are registered formats. The first is ID3v2,
+	// which is used for files of unknown formats.
+	formats = []TagFormat{{
+		Name:       "id3v2",
+		Signatures: []string{"ID3"},
+		Exts:       []string{".mp3"},
+		Reader: TagReaderFunc(func(rs io.ReadSeeker, descriptions []string) (map[string]string, error) {
+			return readTextFrames(rs, descriptions, defaultReadOptions)
+		}),
+	}}
+)
+
+// RegisterTagFormat makes Scanner read files of format f by f.Reader.
+// It's usually called from init function of package with reader.
+// It panics, if f has no name or reader, if signature is longer than
+// 32 bytes or if format with the same name is already registered.
+func RegisterTagFormat(f TagFormat) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	if f.Name == "" || f.Reader == nil {
+		panic("tagrep: RegisterTagFormat with empty name or nil reader")
+	}
+	for _, sig := range f.Signatures {
+		if sig == "" || len(sig) > maxSignatureSize {
+			panic("tagrep: RegisterTagFormat with empty or too long signature")
+		}
+	}
+	for _, other := range formats {
+		if other.Name == f.Name {
+			panic("tagrep: RegisterTagFormat called twice for format " + f.Name)
+		}
+	}
+	formats = append(formats, f)
+}
+
+// TagFormats returns names of registered formats.
+func TagFormats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// readFrames reads frames with descriptions from rs of file with name
+// by reader of its format. Format is detected by signature and then
+// by extension. Files of unknown formats are read as ID3v2 with opts.
+func readFrames(rs io.ReadSeeker, name string, descriptions []string, opts readOptions) (map[string]string, error) {
+	formatsMu.RLock()
+	registered := formats
+	formatsMu.RUnlock()
+	if len(registered) == 1 {
+		// Only ID3v2 is registered, so there is nothing to detect.
+		return readTextFrames(rs, descriptions, opts)
+	}
+
+	var buf [maxSignatureSize]byte
+	n, err := io.ReadFull(rs, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := buf[:n]
+	for i, f := range registered {
+		for _, sig := range f.Signatures {
+			if bytes.HasPrefix(header, []byte(sig)) {
+				if i == 0 {
+					return readTextFrames(rs, descriptions, opts)
+				}
+				return readFormatFrames(f, rs, descriptions)
+			}
+		}
+	}
+	ext := normalizeExt(filepath.Ext(name))
+	for i, f := range registered {
+		for _, e := range f.Exts {
+			if normalizeExt(e) == ext {
+				if i == 0 {
+					return readTextFrames(rs, descriptions, opts)
+				}
+				return readFormatFrames(f, rs, descriptions)
+			}
+		}
+	}
+	return readTextFrames(rs, descriptions, opts)
+}
+
+// readFormatFrames reads frames with descriptions from rs by reader
+// of format f and cleans them like ID3v2 frames.
+func readFormatFrames(f TagFormat, rs io.ReadSeeker, descriptions []string) (map[string]string, error) {
+	frames, err := f.Reader.ReadFrames(rs, descriptions)
+	if err != nil {
+		return nil, err
+	}
+	for d, text := range frames {
+		frames[d] = CleanText(text)
+	}
+	return frames, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import "strings"
+
+// FuzzyThreshold is the minimal similarity of frame to value of
+// fuzzy query, with which frame matches.
+const FuzzyThreshold = 0.7
+
+// partialWeight is a weight of similarity of value to part of frame,
+// so frames equal to value are ranked higher than containing it.
+const partialWeight = 0.9
+
+// Score returns similarity of frames to criteria of q from 0 to 1.
+// It's mean of similarities of artist, title and genre, if they're in q.
+// Year is matched exactly. Query without these criteria scores 1.
+func (q Query) Score(frames map[string]string) float64 {
+	var sum float64
+	var n int
+	for _, c := range []struct{ description, value string }{
+		{"Artist", q.Artist},
+		{"Title", q.Title},
+		{"Genre", q.Genre},
+	} {
+		if c.value == "" {
+			continue
+		}
+		sum += similarity(frames[c.description], c.value)
+		n++
+	}
+	if n == 0 {
+		return 1
+	}
+	return sum / float64(n)
+}
+
+// hasSimilarValue reports whether one of values of text of frame
+// is similar to value at least by FuzzyThreshold.
+func hasSimilarValue(text, value string) bool {
+	return similarity(text, value) >= FuzzyThreshold
+}
+
+// similarity returns the highest similarity of values of text of frame
+// to value. Values are compared case-insensitively by edit distance
+// as whole and by the most similar part of value's length.
+func similarity(text, value string) float64 {
+	v := []rune(strings.ToLower(value))
+	var best float64
+	for _, t := range Values(text) {
+		r := []rune(strings.ToLower(t))
+		if s := ratio(r, v); s > best {
+			best = s
+		}
+		if len(r) > len(v) {
+			for i := 0; i+len(v) <= len(r); i++ {
+				if s := partialWeight * ratio(r[i:i+len(v)], v); s > best {
+					best = s
+				}
+			}
+		}
+	}
+	return best
+}
+
+// ratio returns 1 minus edit distance between a and b divided
+// by length of the longer of them.
+func ratio(a, b []rune) float64 {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+// levenshtein returns edit distance between a and b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"strconv"
+	"strings"
+)
+
+// genres are names of genres of ID3v1 with Winamp extensions
+// indexed by their codes.
+var genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock",
+
+	// Winamp extensions.
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob",
+	"Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde", "Gothic Rock",
+	"Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech",
+	"Chanson", "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass",
+	"Primus", "Porn Groove", "Satire", "Slow Jam", "Club", "Tango", "Samba",
+	"Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore", "Terror",
+	"Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover",
+	"Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock",
+	"Baroque", "Bhangra", "Big Beat", "Breakbeat", "Chillout", "Downtempo",
+	"Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo",
+	"Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock",
+	"New Romantic", "Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance",
+	"Shoegaze", "Space Rock", "Trop Rock", "World Music", "Neoclassical",
+	"Audiobook", "Audio Theatre", "Neue Deutsche Welle", "Podcast",
+	"Indie Rock", "G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// genreName returns name of genre referenced by ref of TCON frame:
+// numeric code of ID3v1, "RX" (remix) or "CR" (cover).
+func genreName(ref string) (string, bool) {
+	switch ref {
+	case "RX":
+		return "Remix", true
+	case "CR":
+		return "Cover", true
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 0 || n >= len(genres) || ref[0] == '+' || ref[0] == '-' {
+		return "", false
+	}
+	return genres[n], true
+}
+
+// NormalizeGenre replaces references to ID3v1 genres in text of TCON
+// frame by their names: "(17)", "(17)Rock" and "17" become "Rock".
+// Several references (e.g. "(51)(39)") become several values separated
+// by ValueSeparator. Refinement after references is kept as another
+// value: "(4)Eurodisco" becomes "Disco" and "Eurodisco". Other values
+// are returned as they are.
+func NormalizeGenre(text string) string {
+	if !strings.ContainsAny(text, "(0123456789RC") {
+		return text
+	}
+	values := Values(text)
+	normalized := make([]string, 0, len(values))
+	for _, v := range values {
+		normalized = append(normalized, normalizeGenreValue(v)...)
+	}
+	return strings.Join(normalized, ValueSeparator)
+}
+
+// normalizeGenreValue returns names of genres referenced by value v
+// of TCON frame.
+func normalizeGenreValue(v string) []string {
+	// ID3v2.4 references are whole values.
+	if name, ok := genreName(v); ok {
+		return []string{name}
+	}
+
+	// ID3v2.3 references are in parentheses before refinement.
+	var names []string
+	rest := v
+	for strings.HasPrefix(rest, "(") && !strings.HasPrefix(rest, "((") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			break
+		}
+		name, ok := genreName(rest[1:end])
+		if !ok {
+			break
+		}
+		names = append(names, name)
+		rest = rest[end+1:]
+	}
+	if len(names) == 0 {
+		if strings.HasPrefix(v, "((") {
+			return []string{v[1:]}
+		}
+		return []string{v}
+	}
+	if strings.HasPrefix(rest, "((") {
+		// Refinement starting with "(" is escaped.
+		rest = rest[1:]
+	}
+	if rest != "" && rest != names[len(names)-1] {
+		names = append(names, rest)
+	}
+	return names
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeGenre(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Rock", []string{"Rock"}},
+		{"17", []string{"Rock"}},
+		{"(17)", []string{"Rock"}},
+		{"(17)Rock", []string{"Rock"}},
+		{"(4)Eurodisco", []string{"Disco", "Eurodisco"}},
+		{"(17)Glam", []string{"Rock", "Glam"}},
+		{"(51)(39)", []string{"Techno-Industrial", "Noise"}},
+		{"(RX)(CR)", []string{"Remix", "Cover"}},
+		{"(17)((Live)", []string{"Rock", "(Live)"}},
+		{"((Live)", []string{"(Live)"}},
+		{"17\x0080", []string{"Rock", "Folk"}},
+		{"(999)", []string{"(999)"}},
+		{"(17", []string{"(17"}},
+		{"+1", []string{"+1"}},
+		{"1984", []string{"1984"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		want := strings.Join(tt.want, ValueSeparator)
+		if got := NormalizeGenre(tt.text); got != want {
+			t.Errorf("NormalizeGenre(%q) = %q, want %q", tt.text, got, want)
+		}
+	}
+}
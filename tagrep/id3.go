@@ -0,0 +1,557 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/bogem/id3v2"
+)
+
+const (
+	tagHeaderSize   = 10
+	frameHeaderSize = 10
+)
+
+// DefaultMaxTagSize is the default maximum size of ID3v2 tag in bytes.
+// Tags with big pictures fit in it.
+const DefaultMaxTagSize = 32 << 20
+
+// maxFrames is the maximum number of frames read from tag. Real tags
+// have few tens of them, so tag with more frames is corrupt.
+const maxFrames = 4096
+
+var (
+	errUnsupportedVersion = errors.New("unsupported version of ID3 tag")
+	errBodyOverflow       = errors.New("frame went over tag area")
+	errTagTooLarge        = errors.New("tag is larger than maximum tag size")
+	errTooManyFrames      = errors.New("tag has too many frames")
+	errEncryptedFrame     = errors.New("frame is encrypted")
+	errShortFrame         = errors.New("frame is shorter than data of its flags")
+	errFrameTooLarge      = errors.New("decompressed frame is larger than maximum tag size")
+)
+
+// readOptions are options of reading ID3v2 tag.
+type readOptions struct {
+	// maxTagSize is the maximum size of tag and of decompressed frame.
+	maxTagSize int64
+	// warn is called for frames, which are skipped, if it's not nil.
+	warn func(err error)
+}
+
+// defaultReadOptions are options of reading by registered reader of ID3v2.
+var defaultReadOptions = readOptions{maxTagSize: DefaultMaxTagSize}
+
+// tagReader holds buffers, which are reused between parsings of tags.
+type tagReader struct {
+	brs  bufReadSeeker
+	buf  []byte // Headers and bodies of frames.
+	text []byte // Decoded text.
+	// found[i] is set, if the i-th requested frame is found.
+	found []bool
+}
+
+var tagReaderPool = sync.Pool{
+	New: func() interface{} {
+		return &tagReader{
+			brs: bufReadSeeker{buf: make([]byte, 4*1024)},
+			buf: make([]byte, 0, 1024),
+		}
+	},
+}
+
+// framesPool is a pool of maps returned by readTextFrames.
+var framesPool = sync.Pool{
+	New: func() interface{} { return make(map[string]string) },
+}
+
+// putFrames puts frames returned by readTextFrames back to pool.
+// frames must not be used after that.
+func putFrames(frames map[string]string) {
+	if frames != nil {
+		clear(frames)
+		framesPool.Put(frames)
+	}
+}
+
+// readTextFrames finds ID3v2 tag at the beginning of rs and returns texts
+// of text frames with given descriptions (e.g. "Artist"), keyed by description.
+// If there is no tag in rs, it returns nil map and nil error. Tags larger
+// than opts.maxTagSize bytes or with more than maxFrames frames are errors.
+// Compressed frames are decompressed, encrypted ones are skipped
+// with warning.
+// Returned map can be put back to pool by putFrames.
+//
+// Unlike id3v2.Tag, it seeks over bodies of not requested frames and
+// stops reading as soon as all requested frames are found, so huge frames
+// like attached pictures are never read.
+func readTextFrames(rs io.ReadSeeker, descriptions []string, opts readOptions) (map[string]string, error) {
+	tr := tagReaderPool.Get().(*tagReader)
+	defer tr.put()
+
+	// Memory-mapped files don't need buffering.
+	if _, ok := rs.(*bytes.Reader); !ok {
+		tr.brs.Reset(rs)
+		defer tr.brs.Reset(nil)
+		rs = &tr.brs
+	}
+
+	header := tr.grow(tagHeaderSize)
+	if _, err := io.ReadFull(rs, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		return nil, nil
+	}
+
+	version := header[3]
+	if version < 3 || version > 4 {
+		return nil, errUnsupportedVersion
+	}
+	// Frame sizes are synchsafe only in ID3v2.4. Tag size is always synchsafe.
+	synchSafe := version == 4
+	framesSize := parseSize(header[6:], true)
+	if framesSize > opts.maxTagSize {
+		return nil, errTagTooLarge
+	}
+
+	// Skip extended header.
+	if header[5]&0x40 != 0 {
+		sizeBuf := tr.grow(4)
+		if _, err := io.ReadFull(rs, sizeBuf); err != nil {
+			return nil, err
+		}
+		// In ID3v2.3 size of extended header excludes size bytes.
+		size := parseSize(sizeBuf, synchSafe)
+		if synchSafe {
+			size -= 4
+		}
+		if _, err := rs.Seek(size, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		framesSize -= 4 + size
+	}
+
+	commonIDs := id3v2.V23CommonIDs
+	if version == 4 {
+		commonIDs = id3v2.V24CommonIDs
+	}
+
+	// Number of requested frames isn't limited, so they're tracked
+	// by slice instead of bit mask.
+	found := tr.resetFound(len(descriptions))
+	remaining := len(descriptions)
+
+	frames := framesPool.Get().(map[string]string)
+	for n := 0; framesSize > frameHeaderSize && remaining > 0; n++ {
+		if n == maxFrames {
+			putFrames(frames)
+			return nil, errTooManyFrames
+		}
+		fh := tr.grow(frameHeaderSize)
+		if _, err := io.ReadFull(rs, fh); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			putFrames(frames)
+			return nil, err
+		}
+		if !isValidID(fh[:4]) {
+			// Padding.
+			break
+		}
+
+		bodySize := parseSize(fh[4:8], synchSafe)
+		framesSize -= frameHeaderSize + bodySize
+		if framesSize < 0 {
+			putFrames(frames)
+			return nil, errBodyOverflow
+		}
+
+		i := indexOfID(fh[:4], descriptions, commonIDs, found)
+		if i < 0 {
+			if _, err := rs.Seek(bodySize, io.SeekCurrent); err != nil {
+				putFrames(frames)
+				return nil, err
+			}
+			continue
+		}
+
+		// Header is in the same buffer as body.
+		id, flags := string(fh[:4]), fh[9]
+		body := tr.grow(int(bodySize))
+		if _, err := io.ReadFull(rs, body); err != nil {
+			putFrames(frames)
+			return nil, err
+		}
+		found[i] = true
+		remaining--
+
+		body, err := frameBody(body, flags, version, opts.maxTagSize)
+		if err == errEncryptedFrame {
+			// Only frames encrypted by taggers themselves can be decrypted.
+			if opts.warn != nil {
+				opts.warn(fmt.Errorf("frame %v is skipped: %w", id, err))
+			}
+			continue
+		}
+		if err != nil {
+			putFrames(frames)
+			return nil, fmt.Errorf("frame %v: %w", id, err)
+		}
+		if len(body) > 0 {
+			text := tr.decodeText(body[0], body[1:])
+			if id == "TCON" {
+				text = NormalizeGenre(text)
+			}
+			frames[descriptions[i]] = text
+		}
+	}
+
+	return frames, nil
+}
+
+// Format flags of frames.
+const (
+	// ID3v2.3 flags.
+	flagCompression23 = 0x80
+	flagEncryption23  = 0x40
+	flagGrouping23    = 0x20
+
+	// ID3v2.4 flags.
+	flagGrouping24          = 0x40
+	flagCompression24       = 0x08
+	flagEncryption24        = 0x04
+	flagUnsynchronisation   = 0x02
+	flagDataLengthIndicator = 0x01
+)
+
+// frameBody returns data of frame in body of ID3v2 version with format
+// flags without data added by flags. Unsynchronised data is restored
+// and compressed is decompressed, if it's not larger than maxSize.
+// Encrypted frames return errEncryptedFrame.
+func frameBody(body []byte, flags, version byte, maxSize int64) ([]byte, error) {
+	var compressed, encrypted, unsynchronised bool
+	var extra int
+	if version == 3 {
+		compressed = flags&flagCompression23 != 0
+		encrypted = flags&flagEncryption23 != 0
+		if compressed {
+			// Decompressed size.
+			extra += 4
+		}
+		if encrypted {
+			// Encryption method.
+			extra++
+		}
+		if flags&flagGrouping23 != 0 {
+			extra++
+		}
+	} else {
+		compressed = flags&flagCompression24 != 0
+		encrypted = flags&flagEncryption24 != 0
+		unsynchronised = flags&flagUnsynchronisation != 0
+		if flags&flagGrouping24 != 0 {
+			extra++
+		}
+		if encrypted {
+			extra++
+		}
+		if flags&flagDataLengthIndicator != 0 {
+			extra += 4
+		}
+	}
+
+	if encrypted {
+		return nil, errEncryptedFrame
+	}
+	if len(body) < extra {
+		return nil, errShortFrame
+	}
+	body = body[extra:]
+	if unsynchronised {
+		body = removeUnsynchronisation(body)
+	}
+	if !compressed {
+		return body, nil
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	// Size of decompressed data isn't trusted.
+	data, err := io.ReadAll(io.LimitReader(zr, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errFrameTooLarge
+	}
+	return data, nil
+}
+
+// removeUnsynchronisation restores data, in which 0x00 was inserted
+// after every 0xFF, in place.
+func removeUnsynchronisation(data []byte) []byte {
+	out := data[:0]
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// indexOfID returns index of description of frame with id,
+// if it's not found yet. Otherwise it returns -1.
+func indexOfID(id []byte, descriptions []string, commonIDs map[string]string, found []bool) int {
+	for i, description := range descriptions {
+		if !found[i] && commonIDs[description] == string(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxPooledBufSize is the maximum capacity of buffer, which is kept in pool.
+const maxPooledBufSize = 64 * 1024
+
+func (tr *tagReader) put() {
+	if cap(tr.buf) > maxPooledBufSize {
+		tr.buf = make([]byte, 0, 1024)
+	}
+	if cap(tr.text) > maxPooledBufSize {
+		tr.text = nil
+	}
+	tagReaderPool.Put(tr)
+}
+
+// grow returns tr.buf with length n.
+func (tr *tagReader) grow(n int) []byte {
+	if cap(tr.buf) < n {
+		tr.buf = make([]byte, n)
+	}
+	return tr.buf[:n]
+}
+
+// resetFound returns tr.found with length n and all elements unset.
+func (tr *tagReader) resetFound(n int) []bool {
+	if cap(tr.found) < n {
+		tr.found = make([]bool, n)
+	}
+	tr.found = tr.found[:n]
+	clear(tr.found)
+	return tr.found
+}
+
+// parseSize parses 4 bytes size of tag or frame.
+func parseSize(data []byte, synchSafe bool) int64 {
+	var size int64
+	for _, b := range data {
+		if synchSafe {
+			size = size<<7 | int64(b&0x7F)
+		} else {
+			size = size<<8 | int64(b)
+		}
+	}
+	return size
+}
+
+// isValidID reports whether id consists of A-Z and 0-9.
+func isValidID(id []byte) bool {
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Text encodings of ID3v2 frames.
+const (
+	encodingISO     = 0
+	encodingUTF16   = 1
+	encodingUTF16BE = 2
+	encodingUTF8    = 3
+)
+
+// decodeText decodes text of frame body encoded with encoding key enc to UTF-8.
+// Text is cleaned by cleanText.
+func (tr *tagReader) decodeText(enc byte, src []byte) string {
+	switch enc {
+	case encodingISO:
+		text := tr.text[:0]
+		for _, b := range src {
+			text = utf8.AppendRune(text, rune(b))
+		}
+		tr.text = text
+		return string(cleanText(text))
+	case encodingUTF16:
+		tr.text = appendUTF16(tr.text[:0], src, false)
+		return string(cleanText(tr.text))
+	case encodingUTF16BE:
+		tr.text = appendUTF16(tr.text[:0], src, true)
+		return string(cleanText(tr.text))
+	default:
+		return string(cleanText(src))
+	}
+}
+
+// CleanText returns text of frame without padding added by some taggers:
+// BOMs at the beginning of values, whitespace at the end of them
+// and trailing NULs, which would be empty values.
+func CleanText(text string) string {
+	return string(cleanText([]byte(text)))
+}
+
+// cleanText is like CleanText, but cleans text in place.
+func cleanText(text []byte) []byte {
+	if !needsCleaning(text) {
+		return text
+	}
+
+	// Cleaned values are never longer than original ones,
+	// so they're written over already read part of text.
+	out := text[:0]
+	for i, v := range bytes.Split(text, []byte(ValueSeparator)) {
+		if i > 0 {
+			out = append(out, 0)
+		}
+		v = bytes.TrimPrefix(v, []byte(bom))
+		out = append(out, bytes.TrimRightFunc(v, unicode.IsSpace)...)
+	}
+	return bytes.TrimRight(out, ValueSeparator)
+}
+
+// bom is byte order mark encoded in UTF-8.
+const bom = "\uFEFF"
+
+// needsCleaning reports whether text must be cleaned by cleanText.
+func needsCleaning(text []byte) bool {
+	if len(text) == 0 {
+		return false
+	}
+	if bytes.Contains(text, []byte(bom)) {
+		return true
+	}
+	r, _ := utf8.DecodeLastRune(text)
+	if r == 0 || unicode.IsSpace(r) {
+		return true
+	}
+	// Values before separators may be padded too.
+	for rest := text; ; {
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 {
+			break
+		}
+		if r, _ := utf8.DecodeLastRune(rest[:i]); i > 0 && unicode.IsSpace(r) {
+			return true
+		}
+		rest = rest[i+1:]
+	}
+	return false
+}
+
+// appendUTF16 decodes UTF-16 text in src to UTF-8 and appends it to dst.
+// Every string in src, which is terminated by NUL, may start with BOM.
+// Otherwise strings are assumed to be big endian if bigEndian is true,
+// and little endian otherwise.
+func appendUTF16(dst, src []byte, bigEndian bool) []byte {
+	start := true
+	for i := 0; i+1 < len(src); i += 2 {
+		if start {
+			start = false
+			if src[i] == 0xFE && src[i+1] == 0xFF {
+				bigEndian = true
+				continue
+			}
+			if src[i] == 0xFF && src[i+1] == 0xFE {
+				bigEndian = false
+				continue
+			}
+		}
+
+		r := rune(utf16Unit(src[i:], bigEndian))
+		if utf16.IsSurrogate(r) && i+3 < len(src) {
+			r = utf16.DecodeRune(r, rune(utf16Unit(src[i+2:], bigEndian)))
+			i += 2
+		}
+		dst = utf8.AppendRune(dst, r)
+		start = r == 0
+	}
+	return dst
+}
+
+func utf16Unit(b []byte, bigEndian bool) uint16 {
+	if bigEndian {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+// bufReadSeeker is a buffered io.ReadSeeker. Small reads are served from
+// buffer, and seeking forward within buffer doesn't touch underlying reader.
+type bufReadSeeker struct {
+	rs   io.ReadSeeker
+	buf  []byte
+	r, w int   // Read and write positions in buf.
+	off  int64 // Offset in rs corresponding to buf[w].
+}
+
+// Reset discards buffered data and switches to reading from rs.
+// rs must be at the beginning.
+func (b *bufReadSeeker) Reset(rs io.ReadSeeker) {
+	b.rs = rs
+	b.r, b.w, b.off = 0, 0, 0
+}
+
+func (b *bufReadSeeker) Read(p []byte) (int, error) {
+	if b.r == b.w {
+		if len(p) >= len(b.buf) {
+			n, err := b.rs.Read(p)
+			b.off += int64(n)
+			return n, err
+		}
+		n, err := b.rs.Read(b.buf)
+		b.r, b.w = 0, n
+		b.off += int64(n)
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, b.buf[b.r:b.w])
+	b.r += n
+	return n, nil
+}
+
+func (b *bufReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	buffered := int64(b.w - b.r)
+	if whence == io.SeekCurrent {
+		if offset >= 0 && offset <= buffered {
+			b.r += int(offset)
+			return b.off - int64(b.w-b.r), nil
+		}
+		offset -= buffered
+	}
+
+	b.r, b.w = 0, 0
+	off, err := b.rs.Seek(offset, whence)
+	b.off = off
+	return off, err
+}
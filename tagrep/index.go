@@ -0,0 +1,246 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexVersion must be incremented, when indexFrames, format of
+// indexEntry or parsed texts of frames are changed. Index and extended
+// attributes with other version are rebuilt.
+const indexVersion = 4
+
+// indexFrames are descriptions of frames stored in index.
+var indexFrames = []string{"Artist", "Title", "Year"}
+
+var (
+	filesBucket = []byte("files")
+	metaBucket  = []byte("meta")
+	versionKey  = []byte("version")
+	updatedKey  = []byte("updated")
+)
+
+// Index is a persistent index of parsed tags, keyed by absolute file paths.
+// Entry of file is valid as long as modification time and size of file
+// are not changed. Index stores only artist, title and year of files,
+// so files are still parsed for queries of other frames, e.g. genre.
+type Index struct {
+	db *bolt.DB
+}
+
+type indexEntry struct {
+	ModTime int64             `json:"mtime"`
+	Size    int64             `json:"size"`
+	Frames  map[string]string `json:"frames,omitempty"`
+}
+
+// DefaultIndexPath returns path of index in user's cache directory.
+func DefaultIndexPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "tagrep.db"
+	}
+	return filepath.Join(dir, "tagrep", "index.db")
+}
+
+// OpenIndex opens index in path. If there is no index, it creates it.
+// Index can't be opened by several processes at the same time.
+func OpenIndex(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		version, _ := json.Marshal(indexVersion)
+		if string(meta.Get(versionKey)) != string(version) {
+			if err := tx.DeleteBucket(filesBucket); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			if err := meta.Put(versionKey, version); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.CreateBucketIfNotExists(filesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Index{db: db}, nil
+}
+
+// Close closes index.
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
+
+// Change is a change of index entry.
+type Change int
+
+// Changes of index entries.
+const (
+	Unchanged Change = iota
+	Added
+	Modified
+	Deleted
+)
+
+func (ch Change) String() string {
+	switch ch {
+	case Added:
+		return "A"
+	case Modified:
+		return "M"
+	case Deleted:
+		return "D"
+	}
+	return " "
+}
+
+// frames returns frames of file in path with file info fi from index.
+// If there is no valid entry for file, it parses file by parse
+// and stores the result in index.
+func (idx *Index) frames(path string, fi os.FileInfo, parse func() (map[string]string, error)) (map[string]string, error) {
+	frames, _, err := idx.update(path, fi, parse)
+	return frames, err
+}
+
+// update is like frames, but it also returns how entry of file was changed.
+func (idx *Index) update(path string, fi os.FileInfo, parse func() (map[string]string, error)) (map[string]string, Change, error) {
+	key := []byte(path)
+
+	var entry indexEntry
+	var exists bool
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(filesBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		exists = true
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	if exists && entry.ModTime == fi.ModTime().UnixNano() && entry.Size == fi.Size() {
+		return entry.Frames, Unchanged, nil
+	}
+
+	frames, err := parse()
+	if err != nil {
+		return nil, Unchanged, err
+	}
+
+	data, err := json.Marshal(indexEntry{
+		ModTime: fi.ModTime().UnixNano(),
+		Size:    fi.Size(),
+		Frames:  frames,
+	})
+	if err != nil {
+		return nil, Unchanged, err
+	}
+	// Batch combines puts from all workers in few transactions.
+	err = idx.db.Batch(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(filesBucket).Put(key, data); err != nil {
+			return err
+		}
+		return touchIndex(tx)
+	})
+	if err != nil {
+		return nil, Unchanged, err
+	}
+
+	if exists {
+		return frames, Modified, nil
+	}
+	return frames, Added, nil
+}
+
+// prune deletes entries of root and of files in root,
+// for which keep returns false. It returns paths of deleted entries.
+func (idx *Index) prune(root string, keep func(path string) bool) ([]string, error) {
+	prefix := []byte(root)
+	if !os.IsPathSeparator(root[len(root)-1]) {
+		prefix = append(prefix, filepath.Separator)
+	}
+
+	var deleted []string
+	err := idx.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+
+		if b.Get([]byte(root)) != nil && !keep(root) {
+			deleted = append(deleted, root)
+		}
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if path := string(k); !keep(path) {
+				deleted = append(deleted, path)
+			}
+		}
+
+		// Keys are deleted after iteration, because
+		// deleting by cursor may skip following keys.
+		for _, path := range deleted {
+			if err := b.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+		return touchIndex(tx)
+	})
+	return deleted, err
+}
+
+// touchIndex records current time as time of the last update of index.
+func touchIndex(tx *bolt.Tx) error {
+	updated, _ := time.Now().MarshalText()
+	return tx.Bucket(metaBucket).Put(updatedKey, updated)
+}
+
+// Updated returns time of the last change of entries of index.
+// If index was never changed, it returns zero time.
+func (idx *Index) Updated() (time.Time, error) {
+	var t time.Time
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		updated := tx.Bucket(metaBucket).Get(updatedKey)
+		if updated == nil {
+			return nil
+		}
+		return t.UnmarshalText(updated)
+	})
+	return t, err
+}
+
+// Len returns number of files in index.
+func (idx *Index) Len() (int, error) {
+	var n int
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(filesBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
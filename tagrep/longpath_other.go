@@ -0,0 +1,15 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+
+package tagrep
+
+// Paths are not limited in length on this platform.
+
+func extendedPath(path string) string { return path }
+
+func fixLongPath(path string) string { return path }
+
+func plainPath(path string) string { return path }
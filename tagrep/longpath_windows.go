@@ -0,0 +1,58 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the maximum length of path, which can be used
+// without extended-length prefix. Directories are limited by
+// MAX_PATH (260) minus room for 8.3 file name.
+const maxShortPath = 248
+
+const (
+	extendedPrefix    = `\\?\`
+	extendedUNCPrefix = `\\?\UNC\`
+)
+
+// extendedPath returns path in extended-length form (\\?\C:\dir or
+// \\?\UNC\server\share\dir), which isn't limited by MAX_PATH.
+// Such path must be absolute and clean, so path is made so.
+func extendedPath(path string) string {
+	if strings.HasPrefix(path, extendedPrefix) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return extendedUNCPrefix + abs[2:]
+	}
+	if filepath.VolumeName(abs) == "" {
+		// E.g. device name like NUL.
+		return path
+	}
+	return extendedPrefix + abs
+}
+
+// fixLongPath returns extendedPath(path), if path is too long
+// to be used as is.
+func fixLongPath(path string) string {
+	if len(path) < maxShortPath {
+		return path
+	}
+	return extendedPath(path)
+}
+
+// plainPath returns path without extended-length prefix.
+func plainPath(path string) string {
+	if strings.HasPrefix(path, extendedUNCPrefix) {
+		return `\\` + path[len(extendedUNCPrefix):]
+	}
+	return strings.TrimPrefix(path, extendedPrefix)
+}
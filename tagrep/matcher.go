@@ -0,0 +1,113 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Matcher is a custom predicate on frames of files, which is added
+// to Query.Matchers. It can match frames with anything, e.g. with
+// external database, without changing traversal and parsing of files.
+type Matcher interface {
+	// Frames returns descriptions of frames needed by Match
+	// (e.g. "Artist" or "Album/Movie/Show title").
+	Frames() []string
+
+	// Match reports whether frames keyed by descriptions match.
+	// Several values of frame are separated by ValueSeparator.
+	// It may be called from several goroutines at the same time.
+	Match(frames map[string]string) bool
+}
+
+// MatcherFactory creates Matcher from argument, e.g. from value
+// of --match in command line.
+type MatcherFactory func(arg string) (Matcher, error)
+
+var (
+	matchersMu sync.RWMutex
+	matchers   = make(map[string]MatcherFactory)
+)
+
+// RegisterMatcher makes factory of matchers available by name.
+// It's usually called from init function of package with matcher.
+// It panics, if name is empty, factory is nil or it's called twice
+// with the same name.
+func RegisterMatcher(name string, factory MatcherFactory) {
+	matchersMu.Lock()
+	defer matchersMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("tagrep: RegisterMatcher with empty name or nil factory")
+	}
+	if _, dup := matchers[name]; dup {
+		panic("tagrep: RegisterMatcher called twice for matcher " + name)
+	}
+	matchers[name] = factory
+}
+
+// NewMatcher creates matcher registered by name with arg.
+func NewMatcher(name, arg string) (Matcher, error) {
+	matchersMu.RLock()
+	factory, ok := matchers[name]
+	matchersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown matcher %q", name)
+	}
+	return factory(arg)
+}
+
+// Matchers returns sorted names of registered matchers.
+func Matchers() []string {
+	matchersMu.RLock()
+	defer matchersMu.RUnlock()
+
+	names := make([]string, 0, len(matchers))
+	for name := range matchers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterMatcher("regexp", newRegexpMatcher)
+}
+
+// regexpMatcher matches frame with regular expression.
+type regexpMatcher struct {
+	description string
+	re          *regexp.Regexp
+}
+
+// newRegexpMatcher creates regexpMatcher from arg like "Artist=^Queen".
+func newRegexpMatcher(arg string) (Matcher, error) {
+	description, expr, ok := strings.Cut(arg, "=")
+	if !ok || description == "" {
+		return nil, fmt.Errorf("argument of regexp matcher must be DESCRIPTION=REGEXP, not %q", arg)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return regexpMatcher{description: description, re: re}, nil
+}
+
+func (m regexpMatcher) Frames() []string {
+	return []string{m.description}
+}
+
+func (m regexpMatcher) Match(frames map[string]string) bool {
+	for _, v := range Values(frames[m.description]) {
+		if m.re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
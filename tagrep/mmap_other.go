@@ -0,0 +1,20 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package tagrep
+
+import "os"
+
+// MmapSupported reports whether Scanner.Mmap is supported on this platform.
+const MmapSupported = false
+
+func mmap(file *os.File, size int64) ([]byte, error) {
+	return nil, ErrMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return nil
+}
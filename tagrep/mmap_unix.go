@@ -0,0 +1,25 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package tagrep
+
+import (
+	"os"
+	"syscall"
+)
+
+// MmapSupported reports whether Scanner.Mmap is supported on this platform.
+const MmapSupported = true
+
+// mmap maps size bytes of file to memory for reading.
+// Returned data must be unmapped by munmap.
+func mmap(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,15 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import "golang.org/x/text/unicode/norm"
+
+// NormalizePath returns path in the form, in which paths are reported
+// in Result. HFS+ and APFS return decomposed (NFD) names, while paths
+// are usually typed and compared composed (NFC), so path is composed.
+// Both forms open the same file on these file systems.
+func NormalizePath(path string) string {
+	return norm.NFC.String(path)
+}
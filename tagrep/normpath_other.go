@@ -0,0 +1,14 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin
+
+package tagrep
+
+// NormalizePath returns path in the form, in which paths are reported
+// in Result. Names of files are arbitrary bytes on this platform,
+// so path is returned as is.
+func NormalizePath(path string) string {
+	return path
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxOpenFiles is the maximum number of files opened by workers at the same
+// time. It's lower than usual limit of file descriptors (1024), so traversal
+// and output always have free descriptors.
+const maxOpenFiles = 256
+
+// openSem is a semaphore limiting number of opened files.
+var openSem = make(chan struct{}, maxOpenFiles)
+
+// maxOpenRetries is how many times openFile retries to open a file,
+// if process is out of file descriptors. Delay between retries
+// is doubled every time starting from 10ms, so it waits ~5s at most.
+const maxOpenRetries = 9
+
+// fileSlot is a slot of openSem taken by opened file.
+// File abandoned by timeout releases its slot by abandon, so blocked
+// opens and reads don't count against maxOpenFiles.
+type fileSlot struct {
+	mu        sync.Mutex
+	taken     bool
+	abandoned bool
+}
+
+// take waits for free slot of openSem. It returns false, if slot
+// is abandoned while waiting.
+func (s *fileSlot) take() bool {
+	openSem <- struct{}{}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.abandoned {
+		<-openSem
+		return false
+	}
+	s.taken = true
+	return true
+}
+
+// release releases slot, if it's taken.
+func (s *fileSlot) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.taken {
+		s.taken = false
+		<-openSem
+	}
+}
+
+// abandon releases slot and prevents taking it again.
+func (s *fileSlot) abandon() {
+	s.mu.Lock()
+	s.abandoned = true
+	s.mu.Unlock()
+	s.release()
+}
+
+// openFile opens the named file for reading like os.Open taking slot.
+// If there are already maxOpenFiles opened files, it waits until one
+// of them is closed. If process is out of file descriptors, it retries
+// with backoff. If slot is abandoned before it's taken, openFile returns
+// errFileTimeout. Returned file must be closed by closeFile.
+func openFile(name string, slot *fileSlot) (*os.File, error) {
+	if !slot.take() {
+		return nil, errFileTimeout
+	}
+
+	delay := 10 * time.Millisecond
+	for i := 0; ; i++ {
+		file, err := os.Open(fixLongPath(name))
+		if err == nil {
+			return file, nil
+		}
+		if !isTooManyOpenFiles(err) || i == maxOpenRetries {
+			slot.release()
+			return nil, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// closeFile closes file opened by openFile with slot.
+func closeFile(file *os.File, slot *fileSlot) error {
+	err := file.Close()
+	slot.release()
+	return err
+}
+
+func isTooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
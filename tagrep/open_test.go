@@ -0,0 +1,47 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSlotAbandon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Abandoned opened file releases its slot once.
+	slot := new(fileSlot)
+	file, err := openFile(path, slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(openSem) != 1 {
+		t.Fatalf("%v slots are taken by opened file, want 1", len(openSem))
+	}
+	slot.abandon()
+	if len(openSem) != 0 {
+		t.Errorf("%v slots are taken after abandon, want 0", len(openSem))
+	}
+	closeFile(file, slot)
+	if len(openSem) != 0 {
+		t.Errorf("%v slots are taken after close, want 0", len(openSem))
+	}
+
+	// File abandoned before opening isn't opened.
+	slot = new(fileSlot)
+	slot.abandon()
+	if _, err := openFile(path, slot); !errors.Is(err, errFileTimeout) {
+		t.Errorf("openFile of abandoned slot returned %v, want errFileTimeout", err)
+	}
+	if len(openSem) != 0 {
+		t.Errorf("%v slots are taken by abandoned open, want 0", len(openSem))
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import "strings"
+
+// Query describes frames, which file must have to be found.
+// Empty fields are not matched.
+type Query struct {
+	Artist string
+	Title  string
+	Year   string
+	// Genre is matched against names of genres, to which references
+	// to ID3v1 genres (e.g. "(17)") are normalized.
+	Genre string
+
+	// IgnoreCase makes matching of frames case-insensitive.
+	// It doesn't affect Matchers.
+	IgnoreCase bool
+
+	// Fuzzy makes artist, title and genre match frames, which are similar
+	// to them at least by FuzzyThreshold. See Score.
+	Fuzzy bool
+
+	// Matchers are custom predicates, which frames must also match.
+	Matchers []Matcher
+}
+
+// IsEmpty reports whether q has no criteria.
+// Scanner finds files with artist, title or year by empty query.
+func (q Query) IsEmpty() bool {
+	return len(q.frames()) == 0 && len(q.Matchers) == 0
+}
+
+// frames returns descriptions of frames needed for matching q.
+func (q Query) frames() []string {
+	var frames []string
+	if q.Artist != "" {
+		frames = append(frames, "Artist")
+	}
+	if q.Title != "" {
+		frames = append(frames, "Title")
+	}
+	if q.Year != "" {
+		frames = append(frames, "Year")
+	}
+	if q.Genre != "" {
+		frames = append(frames, "Genre")
+	}
+	for _, m := range q.Matchers {
+		frames = appendMissing(frames, m.Frames()...)
+	}
+	return frames
+}
+
+// appendMissing appends descriptions to frames, which are not there yet.
+func appendMissing(frames []string, descriptions ...string) []string {
+	for _, d := range descriptions {
+		if !containsString(frames, d) {
+			frames = append(frames, d)
+		}
+	}
+	return frames
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether frames keyed by descriptions (e.g. "Artist") match q.
+// Frame with several values matches, if one of them matches.
+func (q Query) Match(frames map[string]string) bool {
+	if len(frames) == 0 {
+		return false
+	}
+
+	if q.Artist != "" && !q.hasValue(frames["Artist"], q.Artist) {
+		return false
+	}
+	if q.Title != "" && !q.hasValue(frames["Title"], q.Title) {
+		return false
+	}
+	if q.Year != "" && !hasValue(frames["Year"], q.Year, q.IgnoreCase) {
+		return false
+	}
+	if q.Genre != "" && !q.hasValue(frames["Genre"], q.Genre) {
+		return false
+	}
+	for _, m := range q.Matchers {
+		if !m.Match(frames) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValueSeparator separates values of text frame with several values,
+// e.g. of ID3v2.4 frame with several artists.
+const ValueSeparator = "\x00"
+
+// Values returns values of text of frame.
+func Values(text string) []string {
+	return strings.Split(text, ValueSeparator)
+}
+
+// hasValue reports whether text of frame matches value by q.
+func (q Query) hasValue(text, value string) bool {
+	if q.Fuzzy {
+		return hasSimilarValue(text, value)
+	}
+	return hasValue(text, value, q.IgnoreCase)
+}
+
+// hasValue reports whether one of values of text of frame equals value.
+func hasValue(text, value string, ignoreCase bool) bool {
+	if !strings.Contains(text, ValueSeparator) {
+		return areStringsEqual(text, value, ignoreCase)
+	}
+	for _, v := range Values(text) {
+		if areStringsEqual(v, value, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
+func areStringsEqual(a, b string, ignoreCase bool) bool {
+	if ignoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bytes"
+	"io"
+)
+
+// ReadTag reads beginning of file streamed from r, which contains its tag:
+// whole ID3v2 tag or, if formats other than ID3v2 are registered, at most
+// maxTagSize bytes. If maxTagSize is not positive, DefaultMaxTagSize is used.
+// r needn't be seekable, so it may be e.g. stdin or body of HTTP response.
+// The rest of stream isn't read.
+func ReadTag(r io.Reader, maxTagSize int64) ([]byte, error) {
+	if maxTagSize <= 0 {
+		maxTagSize = DefaultMaxTagSize
+	}
+
+	header := make([]byte, tagHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return header[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:3], []byte("ID3")) {
+		formatsMu.RLock()
+		registered := len(formats)
+		formatsMu.RUnlock()
+		if registered == 1 {
+			// File of unknown format is read as ID3v2, so it has no tag.
+			return header, nil
+		}
+		return readAll(io.MultiReader(bytes.NewReader(header), r), maxTagSize)
+	}
+
+	size := parseSize(header[6:], true)
+	if header[5]&0x10 != 0 {
+		// Footer.
+		size += tagHeaderSize
+	}
+	if size > maxTagSize {
+		return nil, errTagTooLarge
+	}
+	data := make([]byte, tagHeaderSize+size)
+	copy(data, header)
+	n, err = io.ReadFull(r, data[tagHeaderSize:])
+	if err == io.ErrUnexpectedEOF {
+		// Truncated tag is reported by parser.
+		err = nil
+	}
+	return data[:tagHeaderSize+n], err
+}
+
+// readAll reads at most n bytes from r.
+func readAll(r io.Reader, n int64) ([]byte, error) {
+	var b bytes.Buffer
+	_, err := b.ReadFrom(io.LimitReader(r, n))
+	return b.Bytes(), err
+}
+
+// MatchReader reads tag of file streamed from r by ReadTag and reports
+// whether frames of file match s.Query. Empty query matches files with tag.
+// name is used as Path and AbsPath of result and for detection of format
+// by extension. Info of result is nil.
+func (s *Scanner) MatchReader(r io.Reader, name string) (Result, bool, error) {
+	data, err := ReadTag(r, s.MaxTagSize)
+	if err != nil {
+		return Result{}, false, err
+	}
+
+	descriptions := s.Query.frames()
+	if len(descriptions) == 0 {
+		descriptions = indexFrames
+	}
+	opts := readOptions{maxTagSize: s.MaxTagSize}
+	if opts.maxTagSize <= 0 {
+		opts.maxTagSize = DefaultMaxTagSize
+	}
+	if s.OnWarning != nil {
+		opts.warn = func(err error) { s.OnWarning(name, err) }
+	}
+	frames, err := readFrames(bytes.NewReader(data), name, descriptions, opts)
+	if err != nil {
+		return Result{}, false, err
+	}
+	if !s.Query.Match(frames) {
+		return Result{}, false, nil
+	}
+	return Result{Path: name, AbsPath: name, Frames: frames}, true, nil
+}
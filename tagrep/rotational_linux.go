@@ -0,0 +1,35 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// isRotational reports whether path is stored on rotational disk (HDD).
+// If it's unknown, it returns false.
+func isRotational(path string) bool {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false
+	}
+
+	major := (st.Dev >> 8) & 0xfff
+	minor := (st.Dev & 0xff) | ((st.Dev >> 12) & 0xfff00)
+	dev := fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+
+	// Partitions don't have queue, it's in their parent device.
+	for _, name := range []string{"queue/rotational", "../queue/rotational"} {
+		data, err := os.ReadFile(filepath.Join(dev, name))
+		if err == nil {
+			return strings.TrimSpace(string(data)) == "1"
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package tagrep
+
+// isRotational reports whether path is stored on rotational disk (HDD).
+// It's supported only on Linux, so it always returns false.
+func isRotational(path string) bool {
+	return false
+}
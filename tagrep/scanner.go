@@ -0,0 +1,827 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tagrep finds audio files with given ID3v2 frames
+// (e.g. artist, title or year).
+//
+// Usage:
+//
+//	s := &tagrep.Scanner{
+//		Query:     tagrep.Query{Artist: "Queen"},
+//		Recursive: true,
+//		Exts:      []string{".mp3"},
+//	}
+//	stats, err := s.Scan(ctx, []string{"/music"}, func(r tagrep.Result) {
+//		fmt.Println(r.Path)
+//	})
+package tagrep
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scanner searches files matching Query.
+// Scanner must not be modified during scan.
+type Scanner struct {
+	// Query is a query files are matched with.
+	Query Query
+
+	// Recursive makes Scanner search in subdirectories.
+	Recursive bool
+
+	// Exts are extensions of files, which are parsed (e.g. ".mp3").
+	// They're matched case-insensitively and may be given without dot.
+	// If Exts is empty, all files are parsed.
+	Exts []string
+
+	// Jobs is number of files parsed in parallel.
+	// If Jobs is 0, DefaultJobs is used.
+	Jobs int
+
+	// MaxCount stops scan after MaxCount found files, if it's positive.
+	MaxCount int64
+
+	// FileTimeout abandons file, if opening and parsing it takes longer.
+	// Blocked I/O can't be interrupted, so parsing goroutine leaks until
+	// I/O is unblocked, but abandoned file doesn't count against limit
+	// of opened files. If FileTimeout is 0, there is no timeout.
+	FileTimeout time.Duration
+
+	// Mmap makes Scanner memory-map files for parsing.
+	// It's supported only if MmapSupported is true.
+	Mmap bool
+
+	// MaxTagSize is the maximum size of ID3v2 tag in bytes. Files with
+	// larger tags are errors, so corrupt file declaring huge tag can't make
+	// Scanner allocate that much memory. If MaxTagSize is 0,
+	// DefaultMaxTagSize is used. Readers of other formats aren't limited.
+	MaxTagSize int64
+
+	// ReadRate limits rate of reading files in bytes per second,
+	// if it's positive.
+	ReadRate int64
+
+	// Index is used to take frames from, if it's not nil.
+	// Only new and modified files are parsed.
+	Index *Index
+
+	// XattrCache makes Scanner cache frames in extended attributes of files.
+	// It's supported only if XattrSupported is true.
+	XattrCache bool
+
+	// Stdin is a reader, from which paths are read, if one of paths is "-".
+	// If Stdin is nil, os.Stdin is used.
+	Stdin io.Reader
+
+	// NullSeparated makes Scanner split paths read from Stdin
+	// by NUL instead of newline.
+	NullSeparated bool
+
+	// Checkpoint records files processed by Scan, if it's not nil.
+	// Files recorded by previous scans are skipped and found ones
+	// among them are counted in Stats.Found and for MaxCount.
+	Checkpoint *Checkpoint
+
+	// OnError is called on every error of reading directory or parsing
+	// file, if it's not nil. Unreadable files and directories are skipped
+	// and counted in Stats.Errors. It may be called from several
+	// goroutines at the same time.
+	OnError func(path string, err error)
+
+	// OnWarning is called on problems of files, which are parsed still,
+	// e.g. on encrypted frames, which are skipped, if it's not nil.
+	// It may be called from several goroutines at the same time.
+	OnWarning func(path string, err error)
+
+	// FailOnError makes scan stop at the first error of reading directory
+	// or parsing file and return it as *FileError. Files being parsed
+	// are finished.
+	FailOnError bool
+
+	// OnMatch is called after every file is matched against Query,
+	// if it's not nil. d is time of reading frames of file from file
+	// or caches. Files with errors are passed to OnError instead.
+	// It may be called from several goroutines at the same time.
+	OnMatch func(path string, matched bool, d time.Duration)
+
+	recursive bool
+	jobs      int
+	exts      map[string]bool
+	wd        string
+	throttle  *throttle
+	total     int64
+	found     int64
+	errors    int64
+	// xattrWarned is 1, if failure of caching frames in extended
+	// attributes is reported to OnWarning.
+	xattrWarned int32
+	// failed are absolute paths, which couldn't be traversed.
+	failed []string
+	// last is a path of the last file sent to matching.
+	// It's written only by traversal.
+	last string
+	// failure is the first error with FailOnError.
+	// It's a pointer, because Scanner is copied before scans.
+	failure *failure
+}
+
+// failure is the first error of scan with Scanner.FailOnError.
+type failure struct {
+	mu  sync.Mutex
+	err error
+	// cancel stops the scan.
+	cancel context.CancelFunc
+}
+
+// fail records err and stops the scan, if err is the first error.
+func (f *failure) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+		if f.cancel != nil {
+			f.cancel()
+		}
+	}
+}
+
+// setCancel sets function, which stops the scan.
+func (f *failure) setCancel(cancel context.CancelFunc) {
+	f.mu.Lock()
+	f.cancel = cancel
+	f.mu.Unlock()
+}
+
+// error returns recorded error.
+func (f *failure) error() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Result is a found file.
+type Result struct {
+	// Path is a path of file as it was found in traversal
+	// normalized by NormalizePath.
+	Path string
+	// AbsPath is an absolute path of file normalized by NormalizePath.
+	AbsPath string
+	// Info is a file info of file.
+	Info fs.FileInfo
+	// Frames are parsed frames of file keyed by descriptions (e.g. "Artist").
+	// Several values of frame are separated by ValueSeparator.
+	Frames map[string]string
+}
+
+// Stats are statistics of scan.
+type Stats struct {
+	// Total is number of traversed files.
+	Total int64
+	// Found is number of found files.
+	Found int64
+	// Errors is number of files and directories, which couldn't be
+	// read or parsed.
+	Errors int64
+	// LastPath is a path of the last file reached by traversal.
+	// If scan is canceled, files after it are not scanned.
+	LastPath string
+}
+
+// ErrMmapUnsupported is returned by Scan, if Scanner.Mmap is set,
+// but it's not supported on this platform.
+var ErrMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// ErrXattrUnsupported is returned by Scan, if Scanner.XattrCache is set,
+// but it's not supported on this platform.
+var ErrXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// DefaultJobs returns number of files parsed in parallel for scanning paths.
+// Matching is mostly I/O bound, so it's bigger than number of CPUs.
+// But parallel reads on rotational disks are slower because of seeks,
+// so only few files are parsed in parallel for them.
+func DefaultJobs(paths []string) int {
+	for _, path := range paths {
+		if path != "-" && isRotational(path) {
+			return 2
+		}
+	}
+	return 4 * runtime.NumCPU()
+}
+
+// Scan searches files matching s.Query in paths and calls found for every
+// found file. Paths can be directories or files. If path is "-", paths are
+// read from s.Stdin. found may be called from several goroutines
+// at the same time.
+//
+// If ctx is canceled, traversal stops, files waiting for matching are
+// skipped and Scan returns ctx.Err() with statistics of scanned files.
+// Scan can be resumed then with the same s.Checkpoint.
+func (s *Scanner) Scan(ctx context.Context, paths []string, found func(Result)) (Stats, error) {
+	if err := s.init(paths, s.Recursive); err != nil {
+		return Stats{}, err
+	}
+
+	// ctx is also canceled, when s.MaxCount is reached.
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.Checkpoint != nil {
+		s.found = s.Checkpoint.found
+	}
+
+	err := s.walk(ctx, paths, func(f file) {
+		if s.Checkpoint != nil && s.Checkpoint.isDone(s.absPath(f.path)) {
+			return
+		}
+		frames, ok := s.match(ctx, f)
+		ok = ok && s.countFound(cancel)
+		if ok {
+			found(s.result(f.path, f.info, frames))
+		}
+		// Files, which weren't parsed because of cancellation,
+		// must be parsed on resume.
+		if s.Checkpoint != nil && (ok || ctx.Err() == nil) {
+			s.Checkpoint.add(s.absPath(f.path), ok)
+		}
+	})
+	if err == nil {
+		err = parent.Err()
+	}
+	return s.stats(), err
+}
+
+// UpdateIndex walks paths recursively and updates s.Index: adds new files,
+// reparses modified ones and removes deleted ones. It calls changed for
+// every changed entry. changed may be called from several goroutines
+// at the same time.
+//
+// If ctx is canceled, UpdateIndex stops and returns ctx.Err().
+// Entries of deleted files are not removed then.
+func (s *Scanner) UpdateIndex(ctx context.Context, paths []string, changed func(path string, ch Change)) (Stats, error) {
+	if s.Index == nil {
+		return Stats{}, errors.New("index is nil")
+	}
+	if err := s.init(paths, true); err != nil {
+		return Stats{}, err
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	err := s.walk(ctx, paths, func(f file) {
+		path := s.absPath(f.path)
+		_, ch, err := s.Index.update(path, f.info, func() (map[string]string, error) {
+			return s.parseFile(ctx, f.path, indexFrames)
+		})
+		if err != nil {
+			s.error(f.path, err)
+		}
+
+		mu.Lock()
+		seen[path] = true
+		mu.Unlock()
+		if ch != Unchanged {
+			changed(path, ch)
+		}
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return s.stats(), err
+	}
+
+	// Remove entries of files, which were not found in paths.
+	// File paths from stdin aren't roots of removal.
+	for _, path := range paths {
+		if path == "-" {
+			continue
+		}
+		// Files in unreadable directories may still exist.
+		deleted, err := s.Index.prune(s.absPath(path), func(path string) bool {
+			return seen[path] || s.isFailed(path)
+		})
+		if err != nil {
+			return s.stats(), err
+		}
+		for _, path := range deleted {
+			changed(path, Deleted)
+		}
+	}
+
+	return s.stats(), nil
+}
+
+// Stat returns file in path with its artist, title and year.
+// Frames are taken from s.Index and extended attributes like in Scan.
+func (s *Scanner) Stat(ctx context.Context, path string) (Result, error) {
+	if err := s.init([]string{path}, false); err != nil {
+		return Result{}, err
+	}
+
+	fi, err := os.Stat(fixLongPath(path))
+	if err != nil {
+		return Result{}, err
+	}
+	if fi.IsDir() {
+		return Result{}, &fs.PathError{Op: "stat", Path: path, Err: errIsDir}
+	}
+
+	frames, err := s.frames(ctx, file{path: path, info: fi}, indexFrames)
+	if err != nil {
+		return Result{}, err
+	}
+	return s.result(path, fi, frames), nil
+}
+
+var errIsDir = errors.New("is a directory")
+
+// Walk calls fn for every file in paths, which would be parsed by Scan,
+// with its artist, title, year and frames needed by s.Query regardless
+// of whether it matches s.Query. Frames of files without tag are empty.
+// Frames are taken from s.Index and extended attributes like in Scan.
+// fn may be called from several goroutines at the same time. Found
+// in returned statistics is number of files passed to fn.
+//
+// If ctx is canceled, Walk stops and returns ctx.Err().
+func (s *Scanner) Walk(ctx context.Context, paths []string, fn func(Result)) (Stats, error) {
+	if err := s.init(paths, s.Recursive); err != nil {
+		return Stats{}, err
+	}
+
+	descriptions := appendMissing(append([]string(nil), indexFrames...), s.Query.frames()...)
+	err := s.walk(ctx, paths, func(f file) {
+		frames, err := s.frames(ctx, f, descriptions)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.error(f.path, err)
+			}
+			return
+		}
+		atomic.AddInt64(&s.found, 1)
+		fn(s.result(f.path, f.info, frames))
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	return s.stats(), err
+}
+
+func (s *Scanner) init(paths []string, recursive bool) error {
+	if s.Mmap && !MmapSupported {
+		return ErrMmapUnsupported
+	}
+	if s.XattrCache && !XattrSupported {
+		return ErrXattrUnsupported
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	s.wd = wd
+
+	s.exts = nil
+	if len(s.Exts) > 0 {
+		s.exts = make(map[string]bool, len(s.Exts))
+		for _, ext := range s.Exts {
+			s.exts[normalizeExt(ext)] = true
+		}
+	}
+
+	s.recursive = recursive
+	s.jobs = s.Jobs
+	if s.jobs <= 0 {
+		s.jobs = DefaultJobs(paths)
+	}
+
+	s.throttle = nil
+	if s.ReadRate > 0 {
+		s.throttle = &throttle{rate: float64(s.ReadRate)}
+	}
+
+	s.total, s.found, s.errors = 0, 0, 0
+	s.xattrWarned = 0
+	s.failed = nil
+	s.last = ""
+	s.failure = &failure{}
+	return nil
+}
+
+func (s *Scanner) stats() Stats {
+	return Stats{Total: atomic.LoadInt64(&s.total), Found: atomic.LoadInt64(&s.found), Errors: atomic.LoadInt64(&s.errors), LastPath: s.last}
+}
+
+func (s *Scanner) error(path string, err error) {
+	atomic.AddInt64(&s.errors, 1)
+	if s.OnError != nil {
+		s.OnError(path, err)
+	}
+	if s.FailOnError {
+		s.failure.fail(&FileError{Path: path, Err: err})
+	}
+}
+
+// countFound counts found file and reports whether it must be reported.
+// If s.MaxCount is reached, it calls stop.
+func (s *Scanner) countFound(stop func()) bool {
+	for {
+		n := atomic.LoadInt64(&s.found)
+		if s.MaxCount > 0 && n >= s.MaxCount {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.found, n, n+1) {
+			if n+1 == s.MaxCount {
+				stop()
+			}
+			return true
+		}
+	}
+}
+
+// absPath returns absolute representation of path normalized
+// by NormalizePath.
+func (s *Scanner) absPath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.wd, path)
+	}
+	return NormalizePath(plainPath(filepath.Clean(path)))
+}
+
+// result returns Result of file in path.
+func (s *Scanner) result(path string, info fs.FileInfo, frames map[string]string) Result {
+	return Result{Path: NormalizePath(path), AbsPath: s.absPath(path), Info: info, Frames: frames}
+}
+
+// file is a file sent by traversal to workers.
+type file struct {
+	path string
+	info fs.FileInfo
+}
+
+// walk traverses paths and calls process for every found file
+// from s.jobs goroutines. It returns when all files are processed
+// or ctx is canceled.
+func (s *Scanner) walk(ctx context.Context, paths []string, process func(file)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.failure.setCancel(cancel)
+
+	files := make(chan file, s.jobs)
+	var wg sync.WaitGroup
+	wg.Add(s.jobs)
+	for i := 0; i < s.jobs; i++ {
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				if ctx.Err() == nil {
+					process(f)
+				}
+			}
+		}()
+	}
+
+	var err error
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		if path == "-" {
+			err = s.searchStdin(ctx, files)
+		} else {
+			err = s.searchPath(ctx, path, files)
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(files)
+	wg.Wait()
+	if err == nil {
+		err = s.failure.error()
+	}
+	return err
+}
+
+// searchStdin reads paths from s.Stdin and searches each of them.
+// Paths are separated by newline or by NUL, if s.NullSeparated is set.
+func (s *Scanner) searchStdin(ctx context.Context, files chan<- file) error {
+	delim := byte('\n')
+	if s.NullSeparated {
+		delim = 0
+	}
+
+	stdin := s.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
+	rd := bufio.NewReader(stdin)
+	for ctx.Err() == nil {
+		path, err := rd.ReadString(delim)
+		if len(path) > 0 && path[len(path)-1] == delim {
+			path = path[:len(path)-1]
+		}
+		if path != "" {
+			if err := s.searchPath(ctx, path, files); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkError passes err of traversing path to OnError and records path,
+// so entries of files in it are not removed from index.
+// Traversal is done by one goroutine, so it's not synchronized.
+func (s *Scanner) walkError(path string, err error) {
+	s.failed = append(s.failed, s.absPath(path))
+	s.error(path, err)
+}
+
+// isFailed reports whether absolute path is in path, which couldn't
+// be traversed.
+func (s *Scanner) isFailed(path string) bool {
+	for _, dir := range s.failed {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchPath searches in path, which can be a directory or a file.
+// If path can't be read, it's skipped.
+func (s *Scanner) searchPath(ctx context.Context, path string, files chan<- file) error {
+	fi, err := os.Stat(fixLongPath(path))
+	if err != nil {
+		s.walkError(path, err)
+		return nil
+	}
+
+	if fi.IsDir() {
+		return s.search(ctx, path, files)
+	}
+
+	return s.searchEntry(path, fs.FileInfoToDirEntry(fi), files)
+}
+
+// search sends files in dir to files.
+// If s.recursive is set, it also searches in subdirectories.
+func (s *Scanner) search(ctx context.Context, dir string, files chan<- file) error {
+	// filepath.WalkDir doesn't follow symlinks, even if it's root.
+	// Trailing separator makes it resolve dir, if it's a symlink.
+	root := dir + string(filepath.Separator)
+	// On Windows dir is walked by extended-length path, so paths
+	// in it aren't limited by MAX_PATH, but they are reported as
+	// they would be without it.
+	walkRoot := root
+	if ext := extendedPath(dir); ext != dir {
+		walkRoot = ext
+		if !os.IsPathSeparator(ext[len(ext)-1]) {
+			walkRoot += string(filepath.Separator)
+		}
+	}
+
+	return filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
+		if walkRoot != root {
+			if path == walkRoot {
+				path = root
+			} else {
+				path = filepath.Join(dir, path[len(walkRoot):])
+			}
+		}
+		if err != nil {
+			// Unreadable directory is skipped, but scan goes on.
+			s.walkError(path, err)
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != root && !s.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return s.searchEntry(path, d, files)
+	})
+}
+
+// searchEntry sends file d in path to files, if it must be matched.
+// Most of files in library are filtered out by extension,
+// so d is stat'ed only after checking its extension.
+func (s *Scanner) searchEntry(path string, d fs.DirEntry, files chan<- file) error {
+	atomic.AddInt64(&s.total, 1)
+
+	if !s.hasExt(d.Name()) {
+		return nil
+	}
+
+	fi, err := d.Info()
+	if errors.Is(err, fs.ErrNotExist) {
+		// File was deleted after reading directory.
+		return nil
+	}
+	if err != nil {
+		s.walkError(path, err)
+		return nil
+	}
+
+	// Check if file is more than 20 bytes.
+	// It makes no sense to parse file less than 20 bytes,
+	// because header of ID3v2 tag and of one frame header equal to 20 bytes.
+	if fi.Size() < 20 {
+		return nil
+	}
+
+	s.last = path
+	files <- file{path: path, info: fi}
+	return nil
+}
+
+// hasExt reports whether file with name must be parsed by its extension.
+func (s *Scanner) hasExt(name string) bool {
+	return len(s.exts) == 0 || s.exts[normalizeExt(filepath.Ext(name))]
+}
+
+// normalizeExt returns lower-case ext with leading dot.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// match reports whether file f matches s.Query.
+// If it matches, it also returns frames of file.
+func (s *Scanner) match(ctx context.Context, f file) (map[string]string, bool) {
+	descriptions := s.Query.frames()
+	if len(descriptions) == 0 {
+		// Empty query matches files with any of these frames.
+		descriptions = indexFrames
+	}
+	if (s.Index != nil || s.XattrCache) && isCached(descriptions) {
+		// Caches store all indexFrames, so they can be used for any query
+		// without custom frames of matchers.
+		descriptions = indexFrames
+	}
+
+	t := time.Now()
+	frames, err := s.frames(ctx, f, descriptions)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.error(f.path, err)
+		}
+		return nil, false
+	}
+	d := time.Since(t)
+
+	matched := s.Query.Match(frames)
+	if s.OnMatch != nil {
+		s.OnMatch(f.path, matched, d)
+	}
+	if !matched {
+		putFrames(frames)
+		return nil, false
+	}
+	return frames, true
+}
+
+// frames returns frames of file f with given descriptions.
+// Frames are taken from s.Index and extended attributes, if they're used
+// and descriptions are indexFrames.
+func (s *Scanner) frames(ctx context.Context, f file, descriptions []string) (map[string]string, error) {
+	parse := func() (map[string]string, error) {
+		return s.parseFile(ctx, f.path, descriptions)
+	}
+	if !isCached(descriptions) {
+		return parse()
+	}
+	if s.XattrCache {
+		parseFile := parse
+		parse = func() (map[string]string, error) {
+			return s.xattrFrames(f.path, f.info, parseFile)
+		}
+	}
+
+	if s.Index != nil {
+		return s.Index.frames(s.absPath(f.path), f.info, parse)
+	}
+	return parse()
+}
+
+// isCached reports whether frames with descriptions are stored in caches,
+// i.e. they're all in indexFrames.
+func isCached(descriptions []string) bool {
+	for _, d := range descriptions {
+		if !containsString(indexFrames, d) {
+			return false
+		}
+	}
+	return true
+}
+
+var errFileTimeout = errors.New("file timeout exceeded")
+
+// parseFile finds ID3v2 tag in file in path and returns texts
+// of frames with given descriptions.
+// If s.FileTimeout is set and parsing takes longer, it returns errFileTimeout.
+// If ctx is canceled during parsing with s.FileTimeout, it returns ctx.Err().
+// Abandoned parsing goroutine leaks until its I/O is unblocked, but its
+// file doesn't count against maxOpenFiles.
+func (s *Scanner) parseFile(ctx context.Context, path string, descriptions []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	slot := new(fileSlot)
+	if s.FileTimeout <= 0 {
+		return s.parseFileFrames(path, descriptions, slot)
+	}
+
+	type result struct {
+		frames map[string]string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		frames, err := s.parseFileFrames(path, descriptions, slot)
+		done <- result{frames, err}
+	}()
+
+	timer := time.NewTimer(s.FileTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.frames, r.err
+	case <-timer.C:
+		slot.abandon()
+		return nil, errFileTimeout
+	case <-ctx.Done():
+		slot.abandon()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Scanner) parseFileFrames(path string, descriptions []string, slot *fileSlot) (map[string]string, error) {
+	file, err := openFile(path, slot)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(file, slot)
+
+	var rs io.ReadSeeker = file
+	if s.Mmap {
+		data, err := mmapFile(file)
+		if err != nil {
+			return nil, err
+		}
+		defer munmap(data)
+		rs = bytes.NewReader(data)
+	}
+	if s.throttle != nil {
+		// Reads of mapped memory are throttled too, as they fault pages in.
+		rs = throttledReadSeeker{rs, s.throttle}
+	}
+
+	opts := readOptions{maxTagSize: s.MaxTagSize}
+	if opts.maxTagSize <= 0 {
+		opts.maxTagSize = DefaultMaxTagSize
+	}
+	if s.OnWarning != nil {
+		opts.warn = func(err error) { s.OnWarning(path, err) }
+	}
+	return readFrames(rs, path, descriptions, opts)
+}
+
+// mmapFile maps whole file to memory.
+func mmapFile(file *os.File) ([]byte, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return mmap(file, fi.Size())
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFrame returns ID3v2.4 text frame with UTF-8 text.
+func testFrame(id, text string) []byte {
+	body := append([]byte{3}, text...)
+	frame := append([]byte(id), synchsafeBytes(len(body))...)
+	return append(append(frame, 0, 0), body...)
+}
+
+// testTag returns ID3v2 tag of version with flags and frames.
+func testTag(version, flags byte, frames ...[]byte) []byte {
+	var body []byte
+	for _, f := range frames {
+		body = append(body, f...)
+	}
+	tag := append([]byte{'I', 'D', '3', version, 0, flags}, synchsafeBytes(len(body))...)
+	return append(tag, body...)
+}
+
+func synchsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// writeTestFile writes data to file in temporary directory
+// and returns its path.
+func writeTestFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFileFramesThrottled(t *testing.T) {
+	path := writeTestFile(t, testTag(4, 0, testFrame("TPE1", "Queen")))
+	for _, mmap := range []bool{false, true} {
+		if mmap && !MmapSupported {
+			continue
+		}
+		s := &Scanner{Mmap: mmap, throttle: &throttle{rate: 1 << 30}}
+		frames, err := s.parseFileFrames(path, []string{"Artist"}, new(fileSlot))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frames["Artist"] != "Queen" {
+			t.Errorf("Artist is %q with mmap %v, want Queen", frames["Artist"], mmap)
+		}
+		if s.throttle.next.IsZero() {
+			t.Errorf("reading isn't throttled with mmap %v", mmap)
+		}
+	}
+}
+
+func TestReadTextFramesManyDescriptions(t *testing.T) {
+	var descriptions []string
+	for i := 0; i < 70; i++ {
+		descriptions = append(descriptions, fmt.Sprint("Unknown", i))
+	}
+	descriptions = append(descriptions, "Artist")
+
+	tag := testTag(4, 0, testFrame("TPE1", "Queen"))
+	frames, err := readTextFrames(bytes.NewReader(tag), descriptions, defaultReadOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames["Artist"] != "Queen" {
+		t.Errorf("Artist is %q after %v other descriptions, want Queen", frames["Artist"], len(descriptions)-1)
+	}
+}
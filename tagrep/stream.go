@@ -0,0 +1,65 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import "context"
+
+// FileError is an error of parsing file sent by Stream
+// or returned by scan with Scanner.FailOnError.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Stream searches files matching s.Query in paths like Scan, but sends
+// found files to results. Errors of parsing files are sent to errs
+// as *FileError. Error, which stopped the scan, is sent to errs last.
+// Both channels are closed, when the scan is finished.
+// If ctx is canceled, results and errors may be dropped.
+//
+// Channels are unbuffered, so the scan waits for caller to receive
+// results and errors. Caller must receive from both channels until
+// they're closed or cancel ctx. s.OnError is not called.
+func (s *Scanner) Stream(ctx context.Context, paths []string) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errs := make(chan error)
+
+	// Scan with copy of s, so OnError of s is not touched.
+	c := *s
+	c.OnError = func(path string, err error) {
+		select {
+		case errs <- &FileError{Path: path, Err: err}:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(results)
+
+		_, err := c.Scan(ctx, paths, func(r Result) {
+			select {
+			case results <- r:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return results, errs
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttle limits rate of some operation to rate units per second.
+type throttle struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time // When next operation is allowed.
+}
+
+// wait waits until operation of n units is allowed.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	d := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(float64(n) / t.rate * float64(time.Second)))
+	t.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// throttledReadSeeker is an io.ReadSeeker, reading of which
+// is limited by throttle t.
+type throttledReadSeeker struct {
+	io.ReadSeeker
+	t *throttle
+}
+
+func (rs throttledReadSeeker) Read(p []byte) (int, error) {
+	n, err := rs.ReadSeeker.Read(p)
+	rs.t.wait(n)
+	return n, err
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleDelay is time, in which file must not be written to,
+// before it's matched. Files are usually written by many small writes,
+// so matching on every write would parse incomplete files.
+const settleDelay = 500 * time.Millisecond
+
+// Watch watches paths for new and modified files and calls found for every
+// of them matching s.Query. Subdirectories of paths, including created ones,
+// are watched too, if s.Recursive is set. found may be called from several
+// goroutines at the same time.
+//
+// Errors of watching are passed to s.OnError with empty path.
+// Watch blocks until ctx is canceled and returns ctx.Err() then.
+// With s.FailOnError it returns the first error instead.
+func (s *Scanner) Watch(ctx context.Context, paths []string, found func(Result)) error {
+	if err := s.init(paths, s.Recursive); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.failure.setCancel(cancel)
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, path := range paths {
+		if err := s.watchPath(w, path, nil); err != nil {
+			return err
+		}
+	}
+
+	// pending are times of last writes to files waiting for matching.
+	pending := make(map[string]time.Time)
+
+	// sem limits number of files matched in parallel.
+	sem := make(chan struct{}, s.jobs)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(settleDelay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.failure.error(); err != nil {
+				return err
+			}
+			return ctx.Err()
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			s.watchEvent(w, ev, pending)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			s.error("", err)
+
+		case now := <-ticker.C:
+			for path, t := range pending {
+				if now.Sub(t) < settleDelay {
+					continue
+				}
+				delete(pending, path)
+
+				sem <- struct{}{}
+				wg.Add(1)
+				go func(path string) {
+					defer func() { <-sem; wg.Done() }()
+					s.watchFile(ctx, path, found)
+				}(path)
+			}
+		}
+	}
+}
+
+// watchPath adds path to w. If path is directory and s.recursive is set,
+// it adds subdirectories too. If pending is not nil, files in path
+// are added to pending, because they could be created before
+// path was watched.
+func (s *Scanner) watchPath(w *fsnotify.Watcher, path string, pending map[string]time.Time) error {
+	if !s.recursive {
+		return w.Add(path)
+	}
+
+	return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		if pending != nil && s.hasExt(d.Name()) {
+			pending[path] = time.Now()
+		}
+		return nil
+	})
+}
+
+// watchEvent handles ev of w.
+func (s *Scanner) watchEvent(w *fsnotify.Watcher, ev fsnotify.Event, pending map[string]time.Time) {
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		delete(pending, ev.Name)
+		return
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+
+	if ev.Has(fsnotify.Create) && s.recursive {
+		fi, err := os.Stat(fixLongPath(ev.Name))
+		if err == nil && fi.IsDir() {
+			if err := s.watchPath(w, ev.Name, pending); err != nil {
+				s.error(ev.Name, err)
+			}
+			return
+		}
+	}
+
+	if s.hasExt(filepath.Base(ev.Name)) {
+		pending[ev.Name] = time.Now()
+	}
+}
+
+// watchFile matches file in path and calls found, if it matches.
+func (s *Scanner) watchFile(ctx context.Context, path string, found func(Result)) {
+	fi, err := os.Stat(fixLongPath(path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.error(path, err)
+		}
+		return
+	}
+
+	// See searchEntry.
+	if fi.IsDir() || fi.Size() < 20 {
+		return
+	}
+
+	f := file{path: path, info: fi}
+	if frames, ok := s.match(ctx, f); ok {
+		found(s.result(path, fi, frames))
+	}
+}
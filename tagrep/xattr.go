@@ -0,0 +1,60 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tagrep
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// xattrName is the name of extended attribute, in which
+// frames of file are cached.
+const xattrName = "user.tagrep.tags"
+
+// xattrEntry is a value of xattrName attribute.
+type xattrEntry struct {
+	Version int `json:"v"`
+	indexEntry
+}
+
+// xattrFrames returns frames of file in path with file info fi cached
+// in its extended attributes. If there are no valid cached frames,
+// it parses file by parse and caches the result.
+func (s *Scanner) xattrFrames(path string, fi os.FileInfo, parse func() (map[string]string, error)) (map[string]string, error) {
+	if data, err := getxattr(path, xattrName); err == nil {
+		var entry xattrEntry
+		if json.Unmarshal(data, &entry) == nil && entry.Version == indexVersion &&
+			entry.ModTime == fi.ModTime().UnixNano() && entry.Size == fi.Size() {
+			return entry.Frames, nil
+		}
+	}
+
+	frames, err := parse()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(xattrEntry{
+		Version: indexVersion,
+		indexEntry: indexEntry{
+			ModTime: fi.ModTime().UnixNano(),
+			Size:    fi.Size(),
+			Frames:  frames,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Filesystem may not support extended attributes or file may be read-only.
+	// It's not an error of parsing, so frames are returned anyway. Other files
+	// likely fail the same way, so only the first failure is reported.
+	if err := setxattr(path, xattrName, data); err != nil && s.OnWarning != nil &&
+		atomic.CompareAndSwapInt32(&s.xattrWarned, 0, 1) {
+		s.OnWarning(path, fmt.Errorf("can't cache tags in extended attributes: %w", err))
+	}
+	return frames, nil
+}
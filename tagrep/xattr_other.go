@@ -0,0 +1,18 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+
+package tagrep
+
+// XattrSupported reports whether Scanner.XattrCache is supported on this platform.
+const XattrSupported = false
+
+func getxattr(path, name string) ([]byte, error) {
+	return nil, ErrXattrUnsupported
+}
+
+func setxattr(path, name string, data []byte) error {
+	return ErrXattrUnsupported
+}
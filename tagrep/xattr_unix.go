@@ -0,0 +1,40 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin
+
+package tagrep
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// XattrSupported reports whether Scanner.XattrCache is supported on this platform.
+const XattrSupported = true
+
+func getxattr(path, name string) ([]byte, error) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := unix.Getxattr(path, name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// Buffer is too small, so get the size of value.
+			n, err = unix.Getxattr(path, name, nil)
+			if err != nil {
+				return nil, err
+			}
+			buf = make([]byte, n)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+func setxattr(path, name string, data []byte) error {
+	return unix.Setxattr(path, name, data, 0)
+}
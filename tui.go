@@ -0,0 +1,495 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+// runTUI runs "tagrep tui" command with args.
+func runTUI(args []string) {
+	flags := tuiFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		if path == "-" {
+			fmt.Println("ERROR: tui can't read paths from stdin")
+			os.Exit(1)
+		}
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Println("ERROR: tui needs terminal as stdin and stderr")
+		os.Exit(1)
+	}
+	if flagXattrCache && !tagrep.XattrSupported {
+		fmt.Println("ERROR: --xattr-cache is not supported on this platform")
+		os.Exit(1)
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.XattrCache = flagXattrCache
+	if flagUseIndex {
+		s.Index = openIndex()
+		defer s.Index.Close()
+	}
+
+	t := &tui{
+		scanner: s,
+		paths:   paths,
+		events:  make(chan interface{}),
+		preview: make(map[string][]frameLine),
+	}
+	selected, err := t.run()
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+	if selected != "" {
+		fmt.Println(selected)
+	}
+}
+
+// tuiFlags returns flags of "tagrep tui" command.
+func tuiFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("tui", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep tui [flags] paths
+
+Interactive browser of files in paths. Type query like
+"artist=Queen year=1975", results are updated as you type.
+Matching is case-insensitive.
+
+Keys: Up/Down and PgUp/PgDn select file, Enter prints selected file
+and exits, Ctrl-U clears query, Esc and Ctrl-C exit.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagIndex, "index", "", "path of index used with --use-index (default is tagrep/index.db in user's cache directory)")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "recursive search")
+	flags.BoolVar(&flagUseIndex, "use-index", false, "take tags from index and parse only new or changed files")
+	flags.BoolVar(&flagXattrCache, "xattr-cache", false, "cache tags in extended attributes of files (user.tagrep.*)")
+	return flags
+}
+
+// tuiDebounce is time, after which query is run, when user stops typing.
+const tuiDebounce = 300 * time.Millisecond
+
+// tui is an interactive browser of found files.
+// It's drawn with ANSI escape sequences to stderr, so stdout
+// stays free for selected file.
+type tui struct {
+	scanner *tagrep.Scanner
+	paths   []string
+
+	// events receives keys, results and ends of scans.
+	events chan interface{}
+
+	query    []rune
+	rows     []tuiRow
+	selected int
+	offset   int
+	scanning bool
+	status   string
+
+	// gen is a generation of current scan.
+	// Results of previous scans are dropped.
+	gen    int
+	cancel context.CancelFunc
+
+	preview map[string][]frameLine
+}
+
+type tuiRow struct {
+	path   string
+	frames map[string]string
+}
+
+type (
+	tuiKey    []byte
+	tuiResult struct {
+		gen int
+		row tuiRow
+	}
+	tuiDone struct {
+		gen int
+		err error
+	}
+)
+
+// errTUIQuit is returned by handleKey, when user exits.
+var errTUIQuit = errors.New("quit")
+
+// run runs t until user exits and returns selected path,
+// if user selected one.
+func (t *tui) run() (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	// Use alternate screen, so terminal is restored after exit.
+	fmt.Fprint(os.Stderr, "\x1b[?1049h")
+	defer fmt.Fprint(os.Stderr, "\x1b[?1049l")
+
+	go t.readKeys()
+
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	// Terminal can be resized, so redraw periodically.
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	defer t.stopScan()
+
+	t.status = `type query like "artist=Queen year=1975"`
+	for {
+		t.draw()
+
+		select {
+		case e := <-t.events:
+			switch e := e.(type) {
+			case tuiKey:
+				query := string(t.query)
+				selected, err := t.handleKey(e)
+				if err == errTUIQuit {
+					return selected, nil
+				}
+				if string(t.query) != query {
+					debounce.Reset(tuiDebounce)
+				}
+			case tuiResult:
+				if e.gen == t.gen {
+					t.rows = append(t.rows, e.row)
+				}
+			case tuiDone:
+				if e.gen == t.gen {
+					t.scanning = false
+					if e.err != nil && !errors.Is(e.err, context.Canceled) {
+						t.status = "ERROR: " + e.err.Error()
+					}
+				}
+			}
+		case <-debounce.C:
+			t.startScan()
+		case <-ticker.C:
+		}
+	}
+}
+
+// readKeys reads keys from stdin and sends them to t.events.
+func (t *tui) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			t.events <- tuiKey{3} // Ctrl-C
+			return
+		}
+		key := make(tuiKey, n)
+		copy(key, buf[:n])
+		t.events <- key
+	}
+}
+
+// handleKey handles key k. If user exits, it returns errTUIQuit
+// and path selected by user, if any.
+func (t *tui) handleKey(k tuiKey) (string, error) {
+	switch {
+	case len(k) == 1 && (k[0] == 3 || k[0] == 0x1b): // Ctrl-C, Esc
+		return "", errTUIQuit
+	case len(k) == 1 && k[0] == '\r':
+		if t.selected < len(t.rows) {
+			return t.rows[t.selected].path, errTUIQuit
+		}
+	case len(k) == 1 && (k[0] == 127 || k[0] == 8): // Backspace
+		if len(t.query) > 0 {
+			t.query = t.query[:len(t.query)-1]
+		}
+	case len(k) == 1 && k[0] == 21: // Ctrl-U
+		t.query = t.query[:0]
+	case string(k) == "\x1b[A":
+		t.selected--
+	case string(k) == "\x1b[B":
+		t.selected++
+	case string(k) == "\x1b[5~":
+		t.selected -= t.listHeight()
+	case string(k) == "\x1b[6~":
+		t.selected += t.listHeight()
+	case k[0] == 0x1b:
+		// Unknown escape sequence.
+	default:
+		for len(k) > 0 {
+			r, size := utf8.DecodeRune(k)
+			if unicode.IsPrint(r) {
+				t.query = append(t.query, r)
+			}
+			k = k[size:]
+		}
+	}
+
+	if t.selected >= len(t.rows) {
+		t.selected = len(t.rows) - 1
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+	return "", nil
+}
+
+// startScan cancels current scan and starts scan of t.query.
+func (t *tui) startScan() {
+	t.stopScan()
+	t.gen++
+	t.rows = t.rows[:0]
+	t.selected, t.offset = 0, 0
+
+	s := *t.scanner
+	s.Query = parseTUIQuery(string(t.query))
+	if s.Query.IsEmpty() {
+		t.scanning = false
+		t.status = `type query like "artist=Queen year=1975"`
+		return
+	}
+	t.scanning = true
+	t.status = ""
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	go t.scan(ctx, &s, t.gen)
+}
+
+func (t *tui) stopScan() {
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+}
+
+// scan scans with s and sends results to t.events.
+func (t *tui) scan(ctx context.Context, s *tagrep.Scanner, gen int) {
+	// Stat can't be called with s, while s scans.
+	stat := *t.scanner
+	var err error
+	results, errs := s.Stream(ctx, t.paths)
+	for results != nil || errs != nil {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			row := tuiRow{path: r.Path, frames: r.Frames}
+			// Query may have only some of columns, so take all of them.
+			if st, err := stat.Stat(ctx, r.Path); err == nil {
+				row.frames = st.Frames
+			}
+			select {
+			case t.events <- tuiResult{gen: gen, row: row}:
+			case <-ctx.Done():
+			}
+		case e, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			var fileErr *tagrep.FileError
+			if !errors.As(e, &fileErr) {
+				err = e
+			}
+		}
+	}
+
+	select {
+	case t.events <- tuiDone{gen: gen, err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// tuiQueryKey matches keys of query.
+var tuiQueryKey = regexp.MustCompile(`\b(artist|title|year)=`)
+
+// parseTUIQuery parses query like "artist=The Beatles year=1965".
+func parseTUIQuery(s string) tagrep.Query {
+	q := tagrep.Query{IgnoreCase: true}
+	keys := tuiQueryKey.FindAllStringSubmatchIndex(s, -1)
+	for i, k := range keys {
+		end := len(s)
+		if i+1 < len(keys) {
+			end = keys[i+1][0]
+		}
+		value := strings.TrimSpace(s[k[1]:end])
+		switch s[k[2]:k[3]] {
+		case "artist":
+			q.Artist = value
+		case "title":
+			q.Title = value
+		case "year":
+			q.Year = value
+		}
+	}
+	return q
+}
+
+// size returns size of terminal.
+func (t *tui) size() (width, height int) {
+	width, height, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// listHeight returns number of rows in list of results.
+func (t *tui) listHeight() int {
+	_, height := t.size()
+	// Query, status and separator lines are not in list.
+	h := (height - 3) / 2
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// draw draws t.
+func (t *tui) draw() {
+	width, height := t.size()
+	listHeight := t.listHeight()
+
+	if t.selected < t.offset {
+		t.offset = t.selected
+	}
+	if t.selected >= t.offset+listHeight {
+		t.offset = t.selected - listHeight + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	// line writes line s, which must be truncated to width.
+	line := func(s string) {
+		b.WriteString("\x1b[2K")
+		b.WriteString(s)
+		b.WriteString("\r\n")
+	}
+
+	line(truncate("> "+string(t.query), width))
+
+	status := fmt.Sprintf("%v found", len(t.rows))
+	if t.scanning {
+		status += ", scanning..."
+	}
+	if t.status != "" {
+		status += " | " + t.status
+	}
+	line("\x1b[2m" + truncate(status, width) + "\x1b[0m")
+
+	for i := t.offset; i < t.offset+listHeight; i++ {
+		if i >= len(t.rows) {
+			line("")
+			continue
+		}
+		r := t.rows[i]
+		s := fmt.Sprintf("%-20v %-30v %-4v %v",
+			truncate(oneLine(r.frames["Artist"]), 20), truncate(oneLine(r.frames["Title"]), 30),
+			truncate(oneLine(r.frames["Year"]), 4), oneLine(r.path))
+		s = truncate(s, width)
+		if i == t.selected {
+			s = "\x1b[7m" + s + "\x1b[0m"
+		}
+		line(s)
+	}
+
+	line(strings.Repeat("─", width))
+
+	previewHeight := height - 3 - listHeight
+	var preview []string
+	if t.selected < len(t.rows) {
+		preview = t.previewLines(t.rows[t.selected].path)
+	}
+	for i := 0; i < previewHeight; i++ {
+		if i < len(preview) {
+			b.WriteString("\x1b[2K")
+			b.WriteString(truncate(preview[i], width))
+		} else {
+			b.WriteString("\x1b[2K")
+		}
+		if i < previewHeight-1 {
+			b.WriteString("\r\n")
+		}
+	}
+
+	// Put cursor at the end of query.
+	fmt.Fprintf(&b, "\x1b[1;%vH", 3+len(t.query))
+	os.Stderr.WriteString(b.String())
+}
+
+// previewLines returns lines with all frames of file in path.
+func (t *tui) previewLines(path string) []string {
+	frames, ok := t.preview[path]
+	if !ok {
+		var err error
+		frames, err = readFrameLines(path)
+		if err != nil {
+			frames = []frameLine{{ID: "ERROR", Text: err.Error()}}
+		}
+		t.preview[path] = frames
+	}
+
+	lines := []string{oneLine(path)}
+	for _, f := range frames {
+		lines = append(lines, f.ID+"  "+oneLine(f.Text))
+	}
+	return lines
+}
+
+// oneLine replaces control characters in s, so s can be drawn in one line.
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// truncate truncates s to n runes.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n])
+}
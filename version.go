@@ -0,0 +1,89 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// Build information injected at build time, e.g.:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+//
+// If they're not set, they're taken from information embedded by go build.
+var version, commit, date string
+
+// versionFlags returns flags of "tagrep version" command.
+func versionFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("version", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep version [flags]
+  tagrep --version
+
+Prints version, commit and date of build and supported tag formats.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+	flags.StringSliceVar(&flagPlugins, "plugin", nil, "load Go plugins registering matchers and tag formats")
+	return flags
+}
+
+// runVersion runs "tagrep version" command with args.
+func runVersion(args []string) {
+	flags := versionFlags()
+	parseFlags(flags, args)
+	loadPlugins()
+
+	v, c, d := buildInfo()
+	fmt.Println("tagrep", v)
+	fmt.Println("commit:", c)
+	fmt.Println("built:", d)
+	fmt.Printf("go: %v %v/%v\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Println("tag formats:", strings.Join(tagrep.TagFormats(), ", "))
+}
+
+// buildInfo returns version, commit and date of build. Values, which
+// weren't injected, are taken from build information of binary.
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = strings.TrimPrefix(info.Main.Version, "v")
+		}
+		settings := make(map[string]string)
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if c == "" && settings["vcs.revision"] != "" {
+			c = settings["vcs.revision"]
+			if settings["vcs.modified"] == "true" {
+				c += "-dirty"
+			}
+		}
+		if d == "" {
+			d = settings["vcs.time"]
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return v, c, d
+}
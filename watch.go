@@ -0,0 +1,115 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/n10v/tagrep/tagrep"
+	"github.com/spf13/pflag"
+)
+
+// runWatch runs "tagrep watch" command with args.
+func runWatch(args []string) {
+	flags := watchFlags()
+	parseFlags(flags, args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = defaultPaths()
+	}
+	if len(paths) == 0 {
+		fmt.Println("ERROR: enter at least one path")
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	s := newScanner()
+	s.Recursive = flagRecursive
+	s.Query = flagQuery()
+	checkQuery(flags, s.Query)
+	if flagNotify {
+		if err := checkDesktopNotify(); err != nil {
+			fmt.Println("ERROR: can't show notifications:", err)
+			os.Exit(1)
+		}
+	}
+	if flagNotify || flagNotifyURL != "" {
+		// Notifications show artist and title of every file.
+		s.Query.Matchers = append(s.Query.Matchers, withFrames{"Artist", "Title", "Year"})
+	}
+
+	sep := byte('\n')
+	if flagPrint0 {
+		sep = 0
+	}
+	out := newPrinter(os.Stdout, sep)
+
+	if flagMetricsAddr != "" {
+		m := newMetrics(s)
+		go func() { fatal("can't serve metrics", serveMetrics(flagMetricsAddr, m)) }()
+	}
+
+	err := s.Watch(context.Background(), paths, func(r tagrep.Result) {
+		if flagAbs {
+			out.Print(r.AbsPath)
+		} else {
+			out.Print(r.Path)
+		}
+		if flagNotifyURL != "" {
+			if err := notifyWebhook(flagNotifyURL, r); err != nil {
+				slog.Error("can't call webhook", "path", r.Path, "err", err)
+			}
+		}
+		if flagNotify {
+			if err := notifyDesktop(r); err != nil {
+				slog.Error("can't show notification", "path", r.Path, "err", err)
+			}
+		}
+	})
+	out.Close()
+	fatal("can't watch", err)
+}
+
+// watchFlags returns flags of "tagrep watch" command.
+func watchFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("watch", pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage:
+  tagrep watch [flags] paths
+
+Watches paths and prints new and modified files with given frames
+until interrupted. With --metrics-addr, metrics of matched files
+in Prometheus format are served on /metrics.
+
+With --notify-url, every file is also posted to given URL as JSON
+object with path, size, mtime and frames. With --notify, desktop
+notification is shown by notify-send or, on macOS, by osascript.
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+
+	addQueryFlags(flags)
+	addListAllFlag(flags)
+	flags.BoolVar(&flagAbs, "abs", false, "print absolute paths")
+	flags.StringSliceVarP(&flagExts, "exts", "e", []string{".mp3"}, `parse files only with given extensions. use "*" for parsing all files`)
+	flags.DurationVar(&flagFileTimeout, "file-timeout", 0, "abandon file, if opening and parsing it takes longer than given duration (e.g. 10s)")
+	flags.IntVarP(&flagJobs, "jobs", "j", 0, "number of files parsed in parallel (default depends on number of CPUs and type of disk)")
+	flags.StringVar(&flagMetricsAddr, "metrics-addr", "", "address to serve /metrics on")
+	flags.BoolVar(&flagNotify, "notify", false, "show desktop notification for every file")
+	flags.StringVar(&flagNotifyURL, "notify-url", "", "post every file as JSON to given webhook URL")
+	flags.BoolVar(&flagMmap, "mmap", false, "use memory-mapped files for reading tags")
+	flags.BoolVar(&flagPrint0, "print0", false, "separate printed paths by NUL instead of newline")
+	flags.BoolVarP(&flagRecursive, "recursive", "r", false, "watch subdirectories too")
+	flags.BoolVarP(&flagVerbose, "verbose", "v", false, "verbose output")
+	addOnErrorFlag(flags)
+	flags.Int64Var(&flagMaxTagSize, "max-tag-size", tagrep.DefaultMaxTagSize, "skip files with ID3v2 tags larger than given size in bytes as unreadable")
+	return flags
+}
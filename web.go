@@ -0,0 +1,79 @@
+// Copyright 2017 Albert Nigmatzianov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"embed"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// webFiles are files of web UI served on / by "tagrep serve".
+//
+//go:embed web/index.html
+var webFiles embed.FS
+
+// webHandler serves web UI.
+func webHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFileFS(w, r, webFiles, "web/index.html")
+	})
+}
+
+// fileHandler serves audio files in paths for playing and downloading
+// from web UI. Only files with extensions of exts are served, if exts
+// is not empty.
+type fileHandler struct {
+	paths []string
+	exts  []string
+}
+
+func (h *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := filepath.Abs(r.URL.Query().Get("path"))
+	if err != nil || !isInPaths(path, h.paths) || !h.hasExt(path) {
+		writeJSONError(w, http.StatusForbidden, "path is not in served paths")
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "file not found")
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		writeJSONError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		name := strings.NewReplacer(`"`, "", "\\", "").Replace(fi.Name())
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	}
+	// ServeContent supports range requests used by players for seeking.
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+// hasExt reports whether file in path has one of h.exts. Extensions
+// are matched like by scanner: case-insensitively and without dot.
+func (h *fileHandler) hasExt(path string) bool {
+	if len(h.exts) == 0 {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for _, e := range h.exts {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}